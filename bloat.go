@@ -0,0 +1,52 @@
+package postgrestore
+
+import (
+	"context"
+)
+
+// BloatEstimate reports how much of the sessions table is taken up by dead rows.
+type BloatEstimate struct {
+	LiveTuples int64
+	DeadTuples int64
+	// TableBytes is the size of the table including its indexes and TOAST data.
+	TableBytes int64
+	// Exact is true when the tuple counts were measured with the pgstattuple extension rather
+	// than taken from the statistics collector's estimates.
+	Exact bool
+	// VacuumRecommended is set when dead tuples exceed 50 plus 20% of the live tuples, the
+	// thresholds autovacuum uses by default.
+	VacuumRecommended bool
+}
+
+// EstimateBloat reports the dead tuples and size of the sessions table, to help decide
+// when a high-churn table needs a VACUUM.  It uses pgstattuple if the extension is installed and
+// otherwise falls back to the estimates in pg_stat_user_tables.  It only reads, but pgstattuple
+// scans the whole table.
+func (dbStore *PGStore) EstimateBloat(ctx context.Context) (*BloatEstimate, error) {
+	estimate := &BloatEstimate{}
+	err := dbStore.withReconnect(func() error {
+		err := dbStore.db.QueryRowContext(ctx,
+			"SELECT pg_total_relation_size($1::regclass);", dbStore.table).Scan(&estimate.TableBytes)
+		if err != nil {
+			return err
+		}
+		err = dbStore.db.QueryRowContext(ctx,
+			"SELECT tuple_count, dead_tuple_count FROM pgstattuple($1);", dbStore.table).Scan(&estimate.LiveTuples, &estimate.DeadTuples)
+		if err == nil {
+			estimate.Exact = true
+			return nil
+		}
+		if isUnavailable(err) {
+			return err
+		}
+		// most likely the extension is not installed (undefined_function) or not accessible
+		return dbStore.db.QueryRowContext(ctx,
+			"SELECT n_live_tup, n_dead_tup FROM pg_stat_user_tables WHERE relid = $1::regclass;", dbStore.table).
+			Scan(&estimate.LiveTuples, &estimate.DeadTuples)
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	estimate.VacuumRecommended = float64(estimate.DeadTuples) > 50+0.2*float64(estimate.LiveTuples)
+	return estimate, nil
+}
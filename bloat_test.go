@@ -0,0 +1,22 @@
+package postgrestore
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_EstimateBloat(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	estimate, err := store.EstimateBloat(context.Background())
+	if err != nil {
+		t.Fatalf("Error estimating bloat: %v", err)
+	}
+	if estimate.TableBytes <= 0 || estimate.LiveTuples < 0 || estimate.DeadTuples < 0 {
+		t.Errorf("Unexpected estimate %+v", estimate)
+	}
+}
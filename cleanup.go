@@ -0,0 +1,118 @@
+package postgrestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Cleanup deletes expired sessions, and sessions whose grace window has passed, and returns the
+// number of rows removed.  load already refuses such sessions; Cleanup keeps the table from
+// growing without bound.  Like load it allows for Config.ExpiryTolerance, so it never removes a
+// session load would still accept.  Flashes of the removed sessions go with them.
+// It covers the whole table, whatever the tenant; see CleanupTenant.
+func (dbStore *PGStore) Cleanup(ctx context.Context) (int64, error) {
+	return dbStore.cleanup(ctx, "")
+}
+
+// cleanup implements Cleanup for the rows matching cond, which must end in " AND " and may
+// reference args.
+//
+// A Save racing the DELETE cannot lose a live session.  The DELETE tests expires_on in the same
+// statement that removes the row, and under READ COMMITTED a DELETE that meets a row locked by
+// a concurrent update waits for it and re-evaluates the condition against the new row version.
+// update writes the refreshed expiry in the same statement as the data, so a Save either
+// commits first and its expiry keeps the row, or finds the row already gone, which only
+// happens to sessions that had expired beyond the tolerance before the Save, and that load
+// therefore already refuses.  The expiry is computed by the application and compared with
+// the database clock; the tolerance also absorbs a small skew between the two.
+func (dbStore *PGStore) cleanup(ctx context.Context, cond string, args ...interface{}) (int64, error) {
+	args = append(args, dbStore.expiryTolerance().Seconds())
+	expired := fmt.Sprintf("expires_on < now() - make_interval(secs => $%d)", len(args))
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s%s;", dbStore.table, cond, expired)
+	if dbStore.config.GraceDeleteWindow > 0 {
+		query = fmt.Sprintf("DELETE FROM %s WHERE %s(%s OR delete_after < now());", dbStore.table, cond, expired)
+	}
+	var removed int64
+	start := time.Now()
+	err := dbStore.withReconnectWrite(func() error {
+		result, err := dbStore.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		removed, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		err = classify(err)
+		dbStore.reportDBError("cleanup", err)
+		return 0, err
+	}
+	if onCleanup := dbStore.config.Hooks.OnCleanup; onCleanup != nil {
+		onCleanup(removed, time.Since(start))
+	}
+	return removed, nil
+}
+
+// DeleteExpired is Cleanup under the name admin tooling looks for: it removes every session
+// past its expiry, plus those whose grace window has passed, and returns the number of rows
+// removed.  No cookies are touched.
+func (dbStore *PGStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return dbStore.Cleanup(ctx)
+}
+
+// StartCleanup runs Cleanup every interval in a background goroutine until StopCleanup or Close
+// is called.  Failures are logged and retried at the next tick.  Calling it while a sweeper is
+// already running replaces that sweeper.
+func (dbStore *PGStore) StartCleanup(interval time.Duration) {
+	dbStore.StopCleanup()
+	quit, done := make(chan struct{}), make(chan struct{})
+	dbStore.cleanupMu.Lock()
+	dbStore.cleanupQuit, dbStore.cleanupDone = quit, done
+	dbStore.cleanupMu.Unlock()
+	go dbStore.sweep(interval, quit, done)
+}
+
+// StopCleanup stops the sweeper started by StartCleanup and waits for it to exit.  It is safe to
+// call more than once, or without a running sweeper.
+func (dbStore *PGStore) StopCleanup() {
+	dbStore.cleanupMu.Lock()
+	quit, done := dbStore.cleanupQuit, dbStore.cleanupDone
+	dbStore.cleanupQuit, dbStore.cleanupDone = nil, nil
+	dbStore.cleanupMu.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+// sweep calls Cleanup every interval until quit is closed, then closes done.
+func (dbStore *PGStore) sweep(interval time.Duration, quit <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				// abandon a slow cleanup as soon as the sweeper is stopped
+				select {
+				case <-quit:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			removed, err := dbStore.Cleanup(ctx)
+			cancel()
+			if err != nil {
+				dbStore.logger.Printf("Unable to clean up expired sessions: %s", err.Error())
+			} else if removed > 0 {
+				dbStore.logger.Printf("Removed %d expired sessions", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package postgrestore
+
+import (
+	"context"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_StopCleanupWithoutSweeper(t *testing.T) {
+	store := &PGStore{}
+	store.StopCleanup()
+	store.StopCleanup()
+}
+
+func Test_CleanupInterval(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, CleanupInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	store.cleanupMu.Lock()
+	running := store.cleanupQuit != nil
+	store.cleanupMu.Unlock()
+	if !running {
+		t.Errorf("Expected New to start the sweeper")
+	}
+	store.Close()
+	if store.cleanupQuit != nil {
+		t.Errorf("Expected Close to stop the sweeper")
+	}
+}
+
+func Test_Cleanup(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	store.config.ExpiryTolerance = 30 * time.Second
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	expired, err := store.New(req, "cleanup-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	expired.Values["expires_on"] = time.Now().Add(-time.Minute)
+	if err = store.Save(req, httptest.NewRecorder(), expired); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	live, err := store.New(req, "cleanup-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), live); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), live)
+	// expired, but within the tolerance load still accepts
+	tolerated, err := store.New(req, "cleanup-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	tolerated.Values["expires_on"] = time.Now().Add(-10 * time.Second)
+	if err = store.Save(req, httptest.NewRecorder(), tolerated); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.stmtDelete.Exec(tolerated.ID)
+
+	removed, err := store.Cleanup(context.Background())
+	if err != nil {
+		t.Fatalf("Error cleaning up: %v", err)
+	}
+	if removed < 1 {
+		t.Errorf("Expected at least the expired session to be removed; Got %d", removed)
+	}
+	if _, err = store.PeekByID(context.Background(), "cleanup-session", expired.ID); err == nil {
+		t.Errorf("Expected the expired session to be gone")
+	}
+	if _, err = store.PeekByID(context.Background(), "cleanup-session", live.ID); err != nil {
+		t.Errorf("Expected the live session to survive; Got %v", err)
+	}
+	if _, err = store.PeekByID(context.Background(), "cleanup-session", tolerated.ID); err != nil {
+		t.Errorf("Expected the session within the expiry tolerance to survive; Got %v", err)
+	}
+
+	store.StartCleanup(10 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	store.StopCleanup()
+	store.StopCleanup()
+}
+
+func Test_CleanupConcurrentSave(t *testing.T) {
+	store, err := New(Config{
+		DSN:             dbUrl,
+		KeyPairs:        [][]byte{[]byte("my-secret-key")},
+		Options:         &sessions.Options{Path: "/", MaxAge: 2},
+		RefreshExpiry:   true,
+		ExpiryTolerance: -1,
+	})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "race-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.DeleteByID(ctx, session.ID)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := store.Cleanup(ctx); err != nil {
+					t.Errorf("Error cleaning up: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	var savers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		savers.Add(1)
+		go func(i int) {
+			defer savers.Done()
+			for n := 0; n < 50; n++ {
+				// every saver holds its own copy of the session, as concurrent requests would
+				own := sessions.NewSession(store, "race-session")
+				own.ID = session.ID
+				opts := *store.Options
+				own.Options = &opts
+				own.Values["saver"] = i
+				if err := store.SaveContext(ctx, nil, httptest.NewRecorder(), own); err != nil {
+					t.Errorf("Error saving session: %v", err)
+					return
+				}
+				if _, err := store.PeekByID(ctx, "race-session", session.ID); err != nil {
+					t.Errorf("Expected the live session to survive cleanup; Got %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	savers.Wait()
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,117 @@
+package postgrestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// compressionMarker starts compressed session data.  Uncompressed data never starts with it:
+// securecookie output is base64, JSON starts with '{' and a gob stream with a non-zero length.
+const compressionMarker = 0x00
+
+// Compressor compresses the stored session data.  Compressed data is stored behind a two byte
+// header, a zero byte followed by the ID of the algorithm, so each row can be decompressed with
+// the algorithm it was written with, whichever algorithm is current.  IDs below 16 are reserved
+// for the compressors of this package; pick another ID to plug in e.g. zstd.
+type Compressor interface {
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// NoCompression stores data as is, but with the compression header.  Configure it to stop
+// compressing new data while older compressed rows stay readable.
+type NoCompression struct{}
+
+// ID implements Compressor.
+func (NoCompression) ID() byte { return 0 }
+
+// Compress implements Compressor.
+func (NoCompression) Compress(data []byte) ([]byte, error) { return data, nil }
+
+// Decompress implements Compressor.
+func (NoCompression) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+// GzipCompressor compresses with gzip at the given Level, gzip.DefaultCompression if zero.
+type GzipCompressor struct {
+	Level int
+}
+
+// ID implements Compressor.
+func (GzipCompressor) ID() byte { return 1 }
+
+// Compress implements Compressor.
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress implements Compressor.
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compress compresses encoded with Config.Compressor, if set, and prepends the header.
+func (dbStore *PGStore) compress(encoded string) (string, error) {
+	c := dbStore.config.Compressor
+	if c == nil {
+		return encoded, nil
+	}
+	data, err := c.Compress([]byte(encoded))
+	if err != nil {
+		return "", err
+	}
+	return string(append([]byte{compressionMarker, c.ID()}, data...)), nil
+}
+
+// decompress undoes compress with the compressor named in the header.  Data without a header
+// is returned as is.
+func (dbStore *PGStore) decompress(stored string) (string, error) {
+	if len(stored) == 0 || stored[0] != compressionMarker {
+		return stored, nil
+	}
+	if len(stored) < 2 {
+		return "", errors.New("postgrestore: truncated compression header")
+	}
+	c := dbStore.decompressor(stored[1])
+	if c == nil {
+		return "", fmt.Errorf("postgrestore: no compressor with ID %d is configured", stored[1])
+	}
+	data, err := c.Decompress([]byte(stored[2:]))
+	return string(data), err
+}
+
+// decompressor returns the compressor with the given ID among the built-in ones,
+// Config.Compressor and Config.Decompressors, or nil.
+func (dbStore *PGStore) decompressor(id byte) Compressor {
+	candidates := append([]Compressor{dbStore.config.Compressor}, dbStore.config.Decompressors...)
+	candidates = append(candidates, NoCompression{}, GzipCompressor{})
+	for _, c := range candidates {
+		if c != nil && c.ID() == id {
+			return c
+		}
+	}
+	return nil
+}
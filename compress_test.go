@@ -0,0 +1,88 @@
+package postgrestore
+
+import (
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// reverseCompressor stands in for a third-party algorithm such as zstd.
+type reverseCompressor struct{}
+
+func (reverseCompressor) ID() byte { return 42 }
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out, nil
+}
+
+func (c reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.Compress(data)
+}
+
+func Test_MixedCompression(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("my-secret-key"))
+	var rows []string
+	for _, compressor := range []Compressor{nil, reverseCompressor{}, GzipCompressor{}, NoCompression{}} {
+		store := &PGStore{Codecs: codecs, config: Config{Compressor: compressor}}
+		session := sessions.NewSession(store, "compressed-session")
+		session.Values["foo"] = "bar"
+		stored, err := store.encodeValues(session)
+		if err != nil {
+			t.Fatalf("Error encoding with %T: %v", compressor, err)
+		}
+		if compressor != nil && (stored[0] != compressionMarker || stored[1] != compressor.ID()) {
+			t.Errorf("Expected a header for %T; Got %q", compressor, stored[:2])
+		}
+		rows = append(rows, stored)
+	}
+
+	// a store that moved on to gzip still reads every row
+	reader := &PGStore{Codecs: codecs, config: Config{Compressor: GzipCompressor{}, Decompressors: []Compressor{reverseCompressor{}}}}
+	for i, stored := range rows {
+		encoded, err := reader.decompress(stored)
+		if err != nil {
+			t.Fatalf("Error decompressing row %d: %v", i, err)
+		}
+		values := make(map[interface{}]interface{})
+		if err = securecookie.DecodeMulti("compressed-session", encoded, &values, codecs...); err != nil || values["foo"] != "bar" {
+			t.Errorf("Expected row %d to round-trip; Got %v, %v", i, values, err)
+		}
+	}
+
+	if _, err := (&PGStore{}).decompress(rows[1]); err == nil {
+		t.Errorf("Expected an error for an unknown compressor")
+	}
+}
+
+func Test_CompressedStore(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Compressor: GzipCompressor{}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.New(req, "compressed-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	loaded, err := store.New(req, "compressed-session")
+	if err != nil || loaded.IsNew || loaded.Values["foo"] != "bar" {
+		t.Errorf("Expected the session to round-trip; Got IsNew=%v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+}
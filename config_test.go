@@ -0,0 +1,72 @@
+package postgrestore
+
+import (
+	"github.com/gorilla/sessions"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_ConfigValidate(t *testing.T) {
+	key := []byte("my-secret-key")
+	valid := Config{DSN: dbUrl, KeyPairs: [][]byte{key}}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("Expected a valid config; Got %v", err)
+	}
+
+	invalid := map[string]Config{
+		"missing DSN":       {KeyPairs: [][]byte{key}},
+		"missing keys":      {DSN: dbUrl},
+		"empty hash key":    {DSN: dbUrl, KeyPairs: [][]byte{nil}},
+		"negative pool":     {DSN: dbUrl, KeyPairs: [][]byte{key}, MaxOpenConns: -1},
+		"idle exceeds open": {DSN: dbUrl, KeyPairs: [][]byte{key}, MaxOpenConns: 2, MaxIdleConns: 5},
+		"negative warmup":   {DSN: dbUrl, KeyPairs: [][]byte{key}, WarmupConnections: -1},
+		"negative cap":      {DSN: dbUrl, KeyPairs: [][]byte{key}, MaxSessionsPerIP: -1},
+		"negative max age":  {DSN: dbUrl, KeyPairs: [][]byte{key}, Options: &sessions.Options{MaxAge: -1}},
+		"unknown ID type":   {DSN: dbUrl, KeyPairs: [][]byte{key}, IDType: "bigserial"},
+		"invalid tenant":    {DSN: dbUrl, KeyPairs: [][]byte{key}, Tenant: "Acme Corp"},
+	}
+	for name, cfg := range invalid {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func Test_EnvironmentApply(t *testing.T) {
+	options := sessions.Options{Path: "/", Secure: true}
+	EnvironmentDefault.apply(&options)
+	if !options.Secure || options.SameSite != 0 {
+		t.Errorf("Expected the default environment to leave options alone; Got %#v", options)
+	}
+	EnvironmentDevelopment.apply(&options)
+	if options.Secure || options.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected SameSite=Lax without Secure; Got %#v", options)
+	}
+	EnvironmentProduction.apply(&options)
+	if !options.Secure || options.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected SameSite=Lax with Secure; Got %#v", options)
+	}
+	invalid := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("key")}, Environment: Environment(7)}
+	if err := invalid.validate(); err == nil {
+		t.Errorf("Expected an error for an unknown environment")
+	}
+}
+
+func Test_BlockKeyWithoutHashKey(t *testing.T) {
+	blockKey := []byte("0123456789abcdef0123456789abcdef")
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key"), nil, nil, blockKey}}
+	err := cfg.validate()
+	if err == nil || !strings.Contains(err.Error(), "a hash key is required to sign cookies") {
+		t.Errorf("Expected an error explaining the missing hash key; Got %v", err)
+	}
+
+	cfg = Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key"), []byte("short-block-key")}}
+	if err = cfg.validate(); err == nil {
+		t.Errorf("Expected an error for a block key of invalid length")
+	}
+	cfg = Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key"), blockKey}}
+	if err = cfg.validate(); err != nil {
+		t.Errorf("Error validating a hash and block key: %v", err)
+	}
+}
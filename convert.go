@@ -0,0 +1,152 @@
+package postgrestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gorilla/sessions"
+)
+
+// convertBatchSize is the number of rows ConvertSerializer reads at a time.
+const convertBatchSize = 500
+
+// convertRow is a row read by ConvertSerializer.
+type convertRow struct {
+	id      string
+	data    []byte
+	dataKey []byte
+}
+
+// ConvertSerializer re-encodes the stored data of the sessions named name from the serializer
+// from to the serializer to, e.g. from GobSerializer to JSONSerializer, so that switching
+// Config.Serializer does not strand the existing sessions.  A nil Serializer stands for the
+// default securecookie codecs, which bind the data to the session name; the other serializers
+// ignore name.  Compression, field encryption and envelope encryption are applied as for a
+// Save, and the expiry and timestamps are left as they are.
+//
+// Rows are read in batches in ID order, and rows that already decode with to are skipped, so
+// the conversion can be interrupted and run again.  Rows that decode with neither, e.g. those
+// of other session names, are logged and skipped.  A row saved while it is being converted keeps
+// what the Save wrote.  Progress is logged after every batch, and the number of rows converted
+// is returned.  A store only reads the format of its own Serializer, so sessions not converted
+// yet start over when loaded by a store already switched to to; run the conversion right after
+// the switch.
+func (dbStore *PGStore) ConvertSerializer(ctx context.Context, name string, from, to Serializer) (int64, error) {
+	var converted, skipped int64
+	last := ""
+	for {
+		rows, err := dbStore.convertBatch(ctx, last)
+		if err != nil {
+			return converted, err
+		}
+		if len(rows) == 0 {
+			return converted, nil
+		}
+		for _, row := range rows {
+			done, err := dbStore.convertRow(ctx, name, row, from, to)
+			if isUnavailable(err) || ctx.Err() != nil {
+				return converted, err
+			} else if err != nil {
+				dbStore.logger.Printf("Unable to convert session %s: %s", dbStore.redact(row.id), err.Error())
+				skipped++
+			} else if done {
+				converted++
+			}
+		}
+		last = rows[len(rows)-1].id
+		dbStore.logger.Printf("Converted %d sessions so far, skipped %d, up to ID %s", converted, skipped, dbStore.redact(last))
+	}
+}
+
+// convertBatch reads the next batch of sessions with an ID above last, or the first batch if
+// last is "".
+func (dbStore *PGStore) convertBatch(ctx context.Context, last string) ([]convertRow, error) {
+	dataKey := "NULL::BYTEA"
+	if dbStore.kms != nil {
+		dataKey = "data_key"
+	}
+	var args []interface{}
+	where := "data <> ''"
+	if last != "" {
+		args = append(args, last)
+		where += fmt.Sprintf(" AND id > $1::%s", dbStore.config.IDType.referenceType())
+	}
+	where += dbStore.tenantCondition(len(args) + 1)
+	args = append(args, dbStore.tenantArgs()...)
+	query := fmt.Sprintf("SELECT id, data, %s FROM %s WHERE %s ORDER BY id LIMIT %d;",
+		dataKey, dbStore.table, where, convertBatchSize)
+	var batch []convertRow
+	err := dbStore.withReconnect(func() error {
+		batch = batch[:0]
+		rows, err := dbStore.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var row convertRow
+			if err = rows.Scan(&row.id, &row.data, &row.dataKey); err != nil {
+				return err
+			}
+			batch = append(batch, row)
+		}
+		return rows.Err()
+	})
+	return batch, classify(err)
+}
+
+// convertRow converts a single row for ConvertSerializer.  It reports whether the row was
+// rewritten.
+func (dbStore *PGStore) convertRow(ctx context.Context, name string, row convertRow, from, to Serializer) (bool, error) {
+	session := sessions.NewSession(dbStore, name)
+	session.ID = row.id
+	opts := *dbStore.Options
+	session.Options = &opts
+	if _, err := dbStore.decodeStoredWith(ctx, session, string(row.data), row.dataKey, to); err == nil {
+		// converted by an earlier run, or saved since the switch
+		return false, nil
+	}
+	session.Values = make(map[interface{}]interface{})
+	if _, err := dbStore.decodeStoredWith(ctx, session, string(row.data), row.dataKey, from); err != nil {
+		return false, err
+	}
+	for _, key := range metadataKeys {
+		delete(session.Values, key)
+	}
+	encoded, err := dbStore.encodeMapWith(session, session.Values, to)
+	if err != nil {
+		return false, err
+	}
+	if encoded, err = dbStore.checkLength(encoded); err != nil {
+		return false, err
+	}
+	var data, wrappedKey interface{} = []byte(encoded), nil
+	if dbStore.kms != nil {
+		if data, wrappedKey, err = dbStore.sealFor(ctx, session, encoded); err != nil {
+			return false, err
+		}
+	}
+	args := []interface{}{data, row.id, row.data}
+	set := "data = $1"
+	if dbStore.kms != nil {
+		args = append(args, wrappedKey)
+		set += fmt.Sprintf(", data_key = $%d", len(args))
+	}
+	// the data condition leaves rows saved in the meantime alone
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $2 AND data = $3%s;",
+		dbStore.table, set, dbStore.tenantCondition(len(args)+1))
+	args = append(args, dbStore.tenantArgs()...)
+	var updated int64
+	err = dbStore.withReconnect(func() error {
+		result, err := dbStore.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		updated, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return false, classify(err)
+	}
+	return updated > 0, nil
+}
@@ -0,0 +1,63 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ConvertSerializer(t *testing.T) {
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "convert_sessions"}
+	old, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer old.Close()
+	defer old.db.Exec("DROP TABLE IF EXISTS convert_sessions;")
+	cfg.Serializer = JSONSerializer{}
+	store, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := old.New(req, "convert-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = old.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	other, _ := old.New(req, "other-session")
+	if err = old.Save(req, httptest.NewRecorder(), other); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	load := func() bool {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+		loaded, err := store.New(req, "convert-session")
+		return err == nil && !loaded.IsNew && loaded.Values["foo"] == "bar"
+	}
+	if load() {
+		t.Fatalf("Expected the unconverted session not to load with the new serializer")
+	}
+	converted, err := store.ConvertSerializer(ctx, "convert-session", nil, JSONSerializer{})
+	if err != nil {
+		t.Fatalf("Error converting sessions: %v", err)
+	}
+	if converted != 1 {
+		t.Errorf("Expected 1 converted session, the other one being named differently; Got %d", converted)
+	}
+	if !load() {
+		t.Errorf("Expected the converted session to load with the new serializer")
+	}
+	if converted, err = store.ConvertSerializer(ctx, "convert-session", nil, JSONSerializer{}); err != nil || converted != 0 {
+		t.Errorf("Expected a second run to skip the converted session; Got %d, %v", converted, err)
+	}
+}
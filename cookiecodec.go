@@ -0,0 +1,80 @@
+package postgrestore
+
+import (
+	"github.com/gorilla/securecookie"
+)
+
+// CookieCodec turns a session ID into the value of the session cookie and back.  It only governs
+// the cookie; the session data stored in the database is always encoded with the store's Codecs.
+// Implement it to emit e.g. PASETO or Branca tokens instead of the securecookie format.
+type CookieCodec interface {
+	Encode(name string, id string) (string, error)
+	Decode(name string, value string) (id string, err error)
+}
+
+// SecureCookieCodec is the default CookieCodec.  It signs, and optionally encrypts, the session
+// ID with securecookie.
+type SecureCookieCodec struct {
+	Codecs []securecookie.Codec
+}
+
+// Encode implements CookieCodec.
+func (c SecureCookieCodec) Encode(name string, id string) (string, error) {
+	return securecookie.EncodeMulti(name, id, c.Codecs...)
+}
+
+// Decode implements CookieCodec.
+func (c SecureCookieCodec) Decode(name string, value string) (string, error) {
+	var id string
+	err := securecookie.DecodeMulti(name, value, &id, c.Codecs...)
+	return id, err
+}
+
+// cookieCodec returns the configured CookieCodec, falling back to a SecureCookieCodec over the
+// store's current Codecs.
+func (dbStore *PGStore) cookieCodec() CookieCodec {
+	if dbStore.CookieCodec != nil {
+		return dbStore.CookieCodec
+	}
+	return SecureCookieCodec{Codecs: dbStore.Codecs}
+}
+
+// decodeCookie decodes the session ID from a cookie value with the store's CookieCodec and, if
+// that fails, with the LegacyCodecs.  The error of the primary codec is returned if neither
+// succeeds.
+func (dbStore *PGStore) decodeCookie(name string, value string) (string, error) {
+	id, err := dbStore.cookieCodec().Decode(name, value)
+	if err != nil && len(dbStore.LegacyCodecs) > 0 {
+		if legacyID, legacyErr := (SecureCookieCodec{Codecs: dbStore.LegacyCodecs}).Decode(name, value); legacyErr == nil {
+			return legacyID, nil
+		}
+	}
+	return id, err
+}
+
+// decodeData decodes stored session data into dst like securecookie.DecodeMulti, and also
+// returns the index of the codec that succeeded.
+func decodeData(name string, value string, dst interface{}, codecs []securecookie.Codec) (int, error) {
+	if len(codecs) == 0 {
+		return -1, securecookie.DecodeMulti(name, value, dst)
+	}
+	var errs securecookie.MultiError
+	for i, codec := range codecs {
+		err := codec.Decode(name, value, dst)
+		if err == nil {
+			return i, nil
+		}
+		errs = append(errs, err)
+	}
+	return -1, errs
+}
+
+// dataCodecs returns the codecs tried when decoding stored session data: the store's Codecs
+// followed by the LegacyCodecs.
+func (dbStore *PGStore) dataCodecs() []securecookie.Codec {
+	if len(dbStore.LegacyCodecs) == 0 {
+		return dbStore.Codecs
+	}
+	codecs := make([]securecookie.Codec, 0, len(dbStore.Codecs)+len(dbStore.LegacyCodecs))
+	return append(append(codecs, dbStore.Codecs...), dbStore.LegacyCodecs...)
+}
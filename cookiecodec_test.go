@@ -0,0 +1,184 @@
+package postgrestore
+
+import (
+	"errors"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// prefixCodec is a transparent CookieCodec used to check that the store routes through it.
+type prefixCodec struct{}
+
+func (prefixCodec) Encode(name string, id string) (string, error) {
+	return "v1." + id, nil
+}
+
+func (prefixCodec) Decode(name string, value string) (string, error) {
+	if !strings.HasPrefix(value, "v1.") {
+		return "", errors.New("unknown token format")
+	}
+	return strings.TrimPrefix(value, "v1."), nil
+}
+
+func Test_SecureCookieCodec(t *testing.T) {
+	codec := SecureCookieCodec{Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key"))}
+	value, err := codec.Encode("session-key", "42")
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	id, err := codec.Decode("session-key", value)
+	if err != nil || id != "42" {
+		t.Errorf("Expected 42; Got %q, %v", id, err)
+	}
+	if _, err = codec.Decode("other-key", value); err == nil {
+		t.Errorf("Expected a value encoded for another name to be rejected")
+	}
+}
+
+func Test_CustomCookieCodec(t *testing.T) {
+	store := &PGStore{
+		Codecs:      securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		Options:     &sessions.Options{Path: "/"},
+		CookieCodec: prefixCodec{},
+	}
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "42"
+	session.Options = store.Options
+	cookie, err := store.PendingCookie(session)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+	if cookie.Value != "v1.42" {
+		t.Errorf("Expected the custom codec to produce v1.42; Got %q", cookie.Value)
+	}
+}
+
+func Test_LegacyCookieCodecs(t *testing.T) {
+	legacy := securecookie.CodecsFromPairs([]byte("old-secret-key"))
+	store := &PGStore{
+		Codecs:       securecookie.CodecsFromPairs([]byte("new-secret-key")),
+		CookieCodec:  prefixCodec{},
+		LegacyCodecs: legacy,
+	}
+	value, err := securecookie.EncodeMulti("session-key", "42", legacy...)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	if id, err := store.decodeCookie("session-key", value); err != nil || id != "42" {
+		t.Errorf("Expected the legacy cookie to decode to 42; Got %q, %v", id, err)
+	}
+	if id, err := store.decodeCookie("session-key", "v1.43"); err != nil || id != "43" {
+		t.Errorf("Expected the primary codec to be tried first; Got %q, %v", id, err)
+	}
+	store.LegacyCodecs = nil
+	if _, err := store.decodeCookie("session-key", value); err == nil {
+		t.Errorf("Expected the legacy cookie to be rejected without LegacyCodecs")
+	}
+}
+
+func Test_DecodeDataIndex(t *testing.T) {
+	old := securecookie.CodecsFromPairs([]byte("old-secret-key"))
+	current := securecookie.CodecsFromPairs([]byte("new-secret-key"))
+	encoded, err := securecookie.EncodeMulti("rotated-session", "value", old...)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	var value string
+	if i, err := decodeData("rotated-session", encoded, &value, append(current, old...)); err != nil || i != 1 || value != "value" {
+		t.Errorf("Expected the second codec to decode; Got %d, %q, %v", i, value, err)
+	}
+	if _, err = decodeData("rotated-session", encoded, &value, current); err == nil {
+		t.Errorf("Expected decoding with the wrong key to fail")
+	}
+}
+
+func Test_KeyRotation(t *testing.T) {
+	oldStore, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("old-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer oldStore.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := oldStore.New(req, "rotated-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = oldStore.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer oldStore.Delete(httptest.NewRecorder(), session)
+	var before string
+	if err = oldStore.db.QueryRow("SELECT data FROM http_sessions WHERE id = $1;", session.ID).Scan(&before); err != nil {
+		t.Fatalf("Error reading session data: %v", err)
+	}
+
+	store, err := New(Config{
+		DSN:         dbUrl,
+		KeyPairs:    [][]byte{[]byte("new-secret-key"), nil, []byte("old-secret-key")},
+		KeyRotation: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	loaded, err := store.New(req, "rotated-session")
+	if err != nil || loaded.IsNew || loaded.Values["foo"] != "bar" {
+		t.Fatalf("Expected the session to load; Got IsNew=%v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+	var after string
+	if err = store.db.QueryRow("SELECT data FROM http_sessions WHERE id = $1;", session.ID).Scan(&after); err != nil {
+		t.Fatalf("Error reading session data: %v", err)
+	}
+	if after == before {
+		t.Errorf("Expected the stored data to be re-encoded")
+	}
+	values := make(map[interface{}]interface{})
+	if err = securecookie.DecodeMulti("rotated-session", after, &values, store.Codecs[0]); err != nil || values["foo"] != "bar" {
+		t.Errorf("Expected the data to decode with the new key alone; Got %v, %v", values, err)
+	}
+}
+
+func Test_EncodeCookie(t *testing.T) {
+	store := &PGStore{
+		Codecs:  securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		Options: &sessions.Options{Path: "/app", MaxAge: 3600, HttpOnly: true, Secure: true},
+	}
+	session := sessions.NewSession(store, "session-key")
+	session.ID = "42"
+	opts := *store.Options
+	session.Options = &opts
+
+	cookie, err := store.EncodeCookie(session)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+	if id, err := store.decodeCookie("session-key", cookie.Value); err != nil || id != "42" {
+		t.Errorf("Expected the cookie to carry ID 42; Got %q, %v", id, err)
+	}
+	if cookie.Path != "/app" || cookie.MaxAge != 3600 || !cookie.HttpOnly || !cookie.Secure {
+		t.Errorf("Expected the session's options on the cookie; Got %#v", cookie)
+	}
+	rsp := httptest.NewRecorder()
+	if err = store.WriteCookie(rsp, session); err != nil {
+		t.Fatalf("Error writing cookie: %v", err)
+	}
+	written := rsp.Result().Cookies()
+	if len(written) != 1 || written[0].Path != cookie.Path || written[0].MaxAge != cookie.MaxAge {
+		t.Errorf("Expected WriteCookie to write the encoded cookie; Got %v", written)
+	}
+
+	session.Options.MaxAge = -1
+	if cookie, err = store.EncodeCookie(session); err != nil || cookie.Value != "" || cookie.MaxAge >= 0 {
+		t.Errorf("Expected an expiring cookie for a negative MaxAge; Got %#v, %v", cookie, err)
+	}
+}
@@ -0,0 +1,46 @@
+package postgrestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Count returns the number of sessions that have not expired yet, as stored: reservations,
+// sessions deleted within the grace window and sessions a load would reject for other reasons
+// are included.  See ActiveCount.  With Config.Tenant only that tenant's sessions are counted.
+func (dbStore *PGStore) Count(ctx context.Context) (int64, error) {
+	return dbStore.count(ctx, []string{"expires_on > now()"})
+}
+
+// ActiveCount returns the number of sessions a load would accept: unexpired sessions, minus
+// uncommitted reservations and, depending on the configuration, sessions that have idled out,
+// were revoked by BumpGlobalGeneration or deleted within the grace window.  Like Count it is
+// restricted to Config.Tenant, if set.
+func (dbStore *PGStore) ActiveCount(ctx context.Context) (int64, error) {
+	conds := []string{"expires_on > now()", "data <> ''"}
+	if dbStore.config.IdleTimeout > 0 {
+		conds = append(conds, fmt.Sprintf("(last_accessed_at IS NULL OR last_accessed_at > now() - interval '%d milliseconds')",
+			dbStore.config.IdleTimeout.Milliseconds()))
+	}
+	if dbStore.config.GlobalGeneration {
+		conds = append(conds, fmt.Sprintf("global_generation >= %s()", dbStore.companionName("generation")))
+	}
+	if dbStore.config.GraceDeleteWindow > 0 {
+		conds = append(conds, "delete_after IS NULL")
+	}
+	return dbStore.count(ctx, conds)
+}
+
+// count returns the number of rows of the store's tenant, if any, matching all of conds.
+func (dbStore *PGStore) count(ctx context.Context, conds []string) (int64, error) {
+	var n int64
+	query := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s%s;", dbStore.table, strings.Join(conds, " AND "), dbStore.tenantCondition(1))
+	err := dbStore.withReconnect(func() error {
+		return dbStore.db.QueryRowContext(ctx, query, dbStore.tenantArgs()...).Scan(&n)
+	})
+	if err != nil {
+		return 0, classify(err)
+	}
+	return n, nil
+}
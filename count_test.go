@@ -0,0 +1,50 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Count(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, EphemeralSchema: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	expired, err := store.New(req, "count-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	expired.Values["expires_on"] = time.Now().Add(-time.Minute)
+	if err = store.Save(req, httptest.NewRecorder(), expired); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	live, err := store.New(req, "count-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), live); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if _, err = store.ReserveID(context.Background()); err != nil {
+		t.Fatalf("Error reserving an ID: %v", err)
+	}
+
+	if n, err := store.Count(context.Background()); err != nil || n != 2 {
+		t.Errorf("Expected the live session and the reservation to be counted; Got %d, %v", n, err)
+	}
+	if n, err := store.ActiveCount(context.Background()); err != nil || n != 1 {
+		t.Errorf("Expected only the live session to be active; Got %d, %v", n, err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = store.Count(canceled); err == nil {
+		t.Errorf("Expected counting with a canceled context to fail")
+	}
+}
@@ -0,0 +1,73 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SessionInfo describes a stored session, without its data, for support and debugging.
+type SessionInfo struct {
+	SessionMeta
+	// CreationContext is the JSON captured by Config.CreationContext from the request that
+	// created the session.  It is nil if the store does not capture it, the session was created
+	// outside of a request or before capturing was enabled.
+	CreationContext json.RawMessage
+}
+
+// addCreationContextColumn adds the "creation_context" column if it is missing.
+func (dbStore *PGStore) addCreationContextColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS creation_context JSONB;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add creation_context column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// creationContext returns the JSON encoded result of Config.CreationContext for r.  It is a
+// debugging aid, so a result that cannot be encoded is logged and stored as NULL rather than
+// failing the save.
+func (dbStore *PGStore) creationContext(r *http.Request) sql.NullString {
+	if r == nil {
+		return sql.NullString{}
+	}
+	captured := dbStore.config.CreationContext(r)
+	if captured == nil {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(captured)
+	if err != nil {
+		dbStore.logger.Printf("Unable to encode the creation context of a session: %s", err.Error())
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// SessionInfo returns the metadata of the session with the given ID, including its creation
+// context if Config.CreationContext is set.  Missing sessions are reported with sql.ErrNoRows.
+func (dbStore *PGStore) SessionInfo(ctx context.Context, id string) (*SessionInfo, error) {
+	cols := "id, created_on, modified_on, expires_on"
+	if dbStore.config.CreationContext != nil {
+		cols += ", creation_context"
+	}
+	info := &SessionInfo{}
+	dest := []interface{}{&info.ID, &info.CreatedOn, zeroIfNull{&info.ModifiedOn}, &info.ExpiresOn}
+	var creationContext []byte
+	if dbStore.config.CreationContext != nil {
+		dest = append(dest, &creationContext)
+	}
+	err := dbStore.withReconnect(func() error {
+		return dbStore.db.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT %s FROM %s WHERE id = $1 AND data <> ''%s;", cols, dbStore.table, dbStore.tenantCondition(2)),
+			append([]interface{}{id}, dbStore.tenantArgs()...)...).Scan(dest...)
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	if creationContext != nil {
+		info.CreationContext = json.RawMessage(creationContext)
+	}
+	return info, nil
+}
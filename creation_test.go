@@ -0,0 +1,62 @@
+package postgrestore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// captureRequest records the method, path and user agent of the creating request.
+func captureRequest(r *http.Request) interface{} {
+	return map[string]string{"method": r.Method, "path": r.URL.Path, "user_agent": r.UserAgent()}
+}
+
+func Test_CreationContextEncoding(t *testing.T) {
+	store := &PGStore{logger: log.New(io.Discard, "", 0), config: Config{CreationContext: captureRequest}}
+	req, _ := http.NewRequest("POST", "http://localhost:8080/login", nil)
+	if captured := store.creationContext(req); !captured.Valid || captured.String != `{"method":"POST","path":"/login","user_agent":""}` {
+		t.Errorf("Unexpected creation context %#v", captured)
+	}
+	if captured := store.creationContext(nil); captured.Valid {
+		t.Errorf("Expected no creation context without a request; Got %q", captured.String)
+	}
+	store.config.CreationContext = func(r *http.Request) interface{} { return make(chan int) }
+	if captured := store.creationContext(req); captured.Valid {
+		t.Errorf("Expected an unencodable creation context to be dropped; Got %q", captured.String)
+	}
+}
+
+func Test_SessionInfo(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, CreationContext: captureRequest})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("POST", "http://localhost:8080/login", nil)
+	req.Header.Set("User-Agent", "postgrestore-test")
+	session, err := store.New(req, "info-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	info, err := store.SessionInfo(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("Error getting session info: %v", err)
+	}
+	var captured map[string]string
+	if err = json.Unmarshal(info.CreationContext, &captured); err != nil {
+		t.Fatalf("Error decoding creation context: %v", err)
+	}
+	if info.ID != session.ID || captured["path"] != "/login" || captured["user_agent"] != "postgrestore-test" {
+		t.Errorf("Unexpected session info %+v, %v", info.SessionMeta, captured)
+	}
+}
@@ -0,0 +1,137 @@
+package postgrestore
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// ConnConfig holds the connection parameters of a PostgreSQL server, for callers that would
+// rather not assemble a connection URL themselves.  Empty fields are left to the driver's
+// defaults, e.g. the PGHOST and PGUSER environment variables.
+type ConnConfig struct {
+	// Host is a host name or address, or the directory of a Unix domain socket.
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+	// SSLMode is one of lib/pq's sslmode values, such as "disable" or "verify-full".
+	SSLMode string
+}
+
+// DSN returns cc as a connection URL.  User, password and database name are escaped, so they
+// may contain characters such as '@', '/' or '%'.
+func (cc ConnConfig) DSN() string {
+	u := url.URL{Scheme: "postgres"}
+	query := url.Values{}
+	host := cc.Host
+	if strings.HasPrefix(host, "/") {
+		// a socket directory cannot be the host part of a URL
+		query.Set("host", host)
+		host = ""
+	}
+	if cc.Port > 0 {
+		if host == "" {
+			query.Set("port", strconv.Itoa(cc.Port))
+		} else {
+			host = net.JoinHostPort(host, strconv.Itoa(cc.Port))
+		}
+	} else if strings.Contains(host, ":") {
+		// a bare IPv6 address
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if cc.Password != "" {
+		u.User = url.UserPassword(cc.User, cc.Password)
+	} else if cc.User != "" {
+		u.User = url.User(cc.User)
+	}
+	if cc.DBName != "" {
+		u.Path = "/" + cc.DBName
+	}
+	if cc.SSLMode != "" {
+		query.Set("sslmode", cc.SSLMode)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// NewPostgreSQLStoreFromConfig creates a store like NewPostgreSQLStore, connecting with the
+// parameters in conn instead of a URL.
+func NewPostgreSQLStoreFromConfig(conn ConnConfig, path string, maxAge int, keyPairs ...[]byte) (*PGStore, error) {
+	return New(Config{
+		DSN: conn.DSN(),
+		Options: &sessions.Options{
+			Path:   path,
+			MaxAge: maxAge,
+		},
+		KeyPairs: keyPairs,
+	})
+}
+
+// dsnParams returns the extra connection parameters implied by cfg, keyed by lib/pq parameter
+// name.  Parameters lib/pq does not recognise, such as statement_timeout, are sent to the server
+// as run-time settings for every connection in the pool.
+func dsnParams(cfg Config) map[string]string {
+	params := map[string]string{}
+	if cfg.ConnectTimeout > 0 {
+		// connect_timeout has a resolution of whole seconds; round up so it never becomes 0
+		params["connect_timeout"] = fmt.Sprint(int64((cfg.ConnectTimeout + time.Second - 1) / time.Second))
+	}
+	if cfg.StatementTimeout > 0 {
+		params["statement_timeout"] = fmt.Sprint(cfg.StatementTimeout.Milliseconds())
+	}
+	if cfg.SearchPath != "" {
+		params["search_path"] = cfg.SearchPath
+	}
+	if cfg.Role != "" {
+		params["role"] = cfg.Role
+	}
+	return params
+}
+
+// withDSNParams adds params to dsn, which may either be a URL ("postgres://...") or a list of
+// key=value pairs.  Parameters already present in dsn are overridden.
+func withDSNParams(dsn string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return dsn, nil
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		for key, value := range params {
+			query.Set(key, value)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	// later key=value pairs take precedence in lib/pq, so appending is enough
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		dsn = fmt.Sprintf("%s %s=%s", dsn, key, quoteDSNValue(params[key]))
+	}
+	return strings.TrimSpace(dsn), nil
+}
+
+// quoteDSNValue quotes value for a key=value connection string if it contains whitespace,
+// quotes or backslashes, e.g. a search_path listing several schemas.
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n'\\") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
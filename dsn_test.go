@@ -0,0 +1,82 @@
+package postgrestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func Test_WithDSNParams(t *testing.T) {
+	params := dsnParams(Config{ConnectTimeout: 1500 * time.Millisecond, StatementTimeout: 2 * time.Second})
+	if params["connect_timeout"] != "2" || params["statement_timeout"] != "2000" {
+		t.Fatalf("Unexpected parameters %v", params)
+	}
+
+	dsn, err := withDSNParams("postgres://postgres@localhost/test?sslmode=disable&connect_timeout=30", params)
+	if err != nil {
+		t.Fatalf("Error adding parameters: %v", err)
+	}
+	if expected := "postgres://postgres@localhost/test?connect_timeout=2&sslmode=disable&statement_timeout=2000"; dsn != expected {
+		t.Errorf("Expected %s; Got %s", expected, dsn)
+	}
+
+	dsn, err = withDSNParams("host=localhost dbname=test", params)
+	if err != nil {
+		t.Fatalf("Error adding parameters: %v", err)
+	}
+	if expected := "host=localhost dbname=test connect_timeout=2 statement_timeout=2000"; dsn != expected {
+		t.Errorf("Expected %s; Got %s", expected, dsn)
+	}
+
+	if dsn, _ = withDSNParams("host=localhost", nil); dsn != "host=localhost" {
+		t.Errorf("Expected the DSN to be left alone; Got %s", dsn)
+	}
+}
+
+func Test_SearchPathAndRoleParams(t *testing.T) {
+	params := dsnParams(Config{SearchPath: "sessions, public", Role: "session_writer"})
+	if params["search_path"] != "sessions, public" || params["role"] != "session_writer" {
+		t.Fatalf("Unexpected parameters %v", params)
+	}
+
+	dsn, err := withDSNParams("host=localhost dbname=test", params)
+	if err != nil {
+		t.Fatalf("Error adding parameters: %v", err)
+	}
+	if expected := "host=localhost dbname=test role=session_writer search_path='sessions, public'"; dsn != expected {
+		t.Errorf("Expected %s; Got %s", expected, dsn)
+	}
+
+	dsn, err = withDSNParams("postgres://postgres@localhost/test", params)
+	if err != nil {
+		t.Fatalf("Error adding parameters: %v", err)
+	}
+	if expected := "postgres://postgres@localhost/test?role=session_writer&search_path=sessions%2C+public"; dsn != expected {
+		t.Errorf("Expected %s; Got %s", expected, dsn)
+	}
+
+	if quoted := quoteDSNValue(`it's`); quoted != `'it\'s'` {
+		t.Errorf("Expected quotes to be escaped; Got %s", quoted)
+	}
+}
+
+func Test_ConnConfigDSN(t *testing.T) {
+	cc := ConnConfig{Host: "localhost", Port: 5432, User: "postgres", Password: "p@ss/w%rd", DBName: "test", SSLMode: "disable"}
+	parsed, err := pq.ParseURL(cc.DSN())
+	if err != nil {
+		t.Fatalf("Error parsing %s: %v", cc.DSN(), err)
+	}
+	if expected := "dbname='test' host='localhost' password='p@ss/w%rd' port='5432' sslmode='disable' user='postgres'"; parsed != expected {
+		t.Errorf("Expected %s; Got %s", expected, parsed)
+	}
+
+	cc = ConnConfig{Host: "/var/run/postgresql", Port: 5433, DBName: "test"}
+	if expected := "postgres:///test?host=%2Fvar%2Frun%2Fpostgresql&port=5433"; cc.DSN() != expected {
+		t.Errorf("Expected %s; Got %s", expected, cc.DSN())
+	}
+	cc = ConnConfig{Host: "::1", User: "postgres"}
+	if expected := "postgres://postgres@[::1]"; cc.DSN() != expected {
+		t.Errorf("Expected %s; Got %s", expected, cc.DSN())
+	}
+}
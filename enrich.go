@@ -0,0 +1,15 @@
+package postgrestore
+
+import (
+	"context"
+	"github.com/gorilla/sessions"
+)
+
+// enrich drops the EnrichKeys from the decoded session.Values, in case they were stored by a
+// version that did not strip them, and calls Config.Enrich to set them afresh.
+func (dbStore *PGStore) enrich(ctx context.Context, session *sessions.Session) error {
+	for _, key := range dbStore.config.EnrichKeys {
+		delete(session.Values, key)
+	}
+	return dbStore.config.Enrich(ctx, session)
+}
@@ -0,0 +1,73 @@
+package postgrestore
+
+import (
+	"context"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// enrichFlags sets an ephemeral "flags" value.
+func enrichFlags(ctx context.Context, session *sessions.Session) error {
+	session.Values["flags"] = "beta"
+	return nil
+}
+
+func Test_EnrichKeysNotEncoded(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("my-secret-key"))
+	store := &PGStore{Codecs: codecs, config: Config{Enrich: enrichFlags, EnrichKeys: []string{"flags"}}}
+	session := sessions.NewSession(store, "enrich-session")
+	session.Values["foo"] = "bar"
+	session.Values["flags"] = "beta"
+	encoded, err := store.encodeValues(session)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	values := make(map[interface{}]interface{})
+	if err = securecookie.DecodeMulti("enrich-session", encoded, &values, codecs...); err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if _, ok := values["flags"]; ok || values["foo"] != "bar" {
+		t.Errorf("Expected only foo to be encoded; Got %v", values)
+	}
+	if session.Values["flags"] != "beta" {
+		t.Errorf("Expected session.Values to be left untouched")
+	}
+
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Enrich: enrichFlags}
+	if err = cfg.validate(); err == nil {
+		t.Errorf("Expected Enrich without EnrichKeys to be rejected")
+	}
+}
+
+func Test_Enrich(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Enrich: enrichFlags, EnrichKeys: []string{"flags"}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.New(req, "enrich-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	loaded, err := store.New(req, "enrich-session")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the session to load; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+	if loaded.Values["flags"] != "beta" || loaded.Values["foo"] != "bar" {
+		t.Errorf("Expected the enriched and the stored values; Got %v", loaded.Values)
+	}
+}
@@ -0,0 +1,121 @@
+package postgrestore
+
+import (
+	"container/list"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrTooManyFailedLoads is returned by Get and New, along with a new session, for requests from
+// a client that presented too many session cookies without a matching session; see
+// EnumerationGuard.  The message is deliberately generic.
+var ErrTooManyFailedLoads = errors.New("postgrestore: session unavailable")
+
+// EnumerationGuard detects clients probing for session IDs, which are serial, by counting loads
+// whose cookie decoded fine but named no stored session.
+type EnumerationGuard struct {
+	// Threshold is the number of failed loads within Window after which a client's session
+	// cookies are rejected with ErrTooManyFailedLoads until the window ends.  Zero disables
+	// the guard.
+	Threshold int
+
+	// Window is the period failures are counted over, one hour by default.  It starts with the
+	// first failure of a client.
+	Window time.Duration
+
+	// MaxClients bounds the memory used for tracking: once that many clients are tracked, the
+	// least recently failing one is forgotten.  Defaults to 10000.
+	MaxClients int
+
+	// OnSuspiciousActivity, if set, is called once per window when a client reaches the
+	// threshold, e.g. to alert or to block the address upstream.  It must not block.
+	OnSuspiciousActivity func(ip string, failures int)
+}
+
+// enumerationGuard holds the failure counters of an EnumerationGuard in an LRU list.
+type enumerationGuard struct {
+	EnumerationGuard
+	mu      sync.Mutex
+	lru     *list.List
+	clients map[string]*list.Element
+}
+
+// failures counts the failed loads of one client.
+type failures struct {
+	ip    string
+	since time.Time
+	count int
+}
+
+// newEnumerationGuard applies the defaults to cfg.
+func newEnumerationGuard(cfg EnumerationGuard) *enumerationGuard {
+	if cfg.Window == 0 {
+		cfg.Window = time.Hour
+	}
+	if cfg.MaxClients == 0 {
+		cfg.MaxClients = 10000
+	}
+	return &enumerationGuard{EnumerationGuard: cfg, lru: list.New(), clients: make(map[string]*list.Element)}
+}
+
+// lookup returns the counter of ip, or nil if it has none or its window has ended.  The caller
+// must hold g.mu.
+func (g *enumerationGuard) lookup(ip string, now time.Time) *failures {
+	elem, ok := g.clients[ip]
+	if !ok {
+		return nil
+	}
+	f := elem.Value.(*failures)
+	if now.Sub(f.since) > g.Window {
+		g.lru.Remove(elem)
+		delete(g.clients, ip)
+		return nil
+	}
+	return f
+}
+
+// blocked reports whether ip has reached the threshold within its current window.
+func (g *enumerationGuard) blocked(ip string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f := g.lookup(ip, time.Now())
+	return f != nil && f.count >= g.Threshold
+}
+
+// fail records a failed load by ip and calls OnSuspiciousActivity when it reaches the threshold.
+func (g *enumerationGuard) fail(ip string) {
+	now := time.Now()
+	g.mu.Lock()
+	f := g.lookup(ip, now)
+	if f == nil {
+		f = &failures{ip: ip, since: now}
+		g.clients[ip] = g.lru.PushFront(f)
+		if g.lru.Len() > g.MaxClients {
+			oldest := g.lru.Back()
+			g.lru.Remove(oldest)
+			delete(g.clients, oldest.Value.(*failures).ip)
+		}
+	} else {
+		g.lru.MoveToFront(g.clients[ip])
+	}
+	f.count++
+	count := f.count
+	g.mu.Unlock()
+	if count == g.Threshold && g.OnSuspiciousActivity != nil {
+		g.OnSuspiciousActivity(ip, count)
+	}
+}
+
+// clientIP returns the host part of r.RemoteAddr.  Behind a proxy, RemoteAddr must be set to
+// the client's address, e.g. by middleware trusting X-Forwarded-For, for the guard to tell
+// clients apart.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,68 @@
+package postgrestore
+
+import (
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_EnumerationGuard(t *testing.T) {
+	var reported []string
+	guard := newEnumerationGuard(EnumerationGuard{
+		Threshold:            3,
+		MaxClients:           2,
+		OnSuspiciousActivity: func(ip string, failures int) { reported = append(reported, ip) },
+	})
+	for i := 0; i < 4; i++ {
+		guard.fail("10.0.0.1")
+	}
+	if !guard.blocked("10.0.0.1") || guard.blocked("10.0.0.2") {
+		t.Errorf("Expected only 10.0.0.1 to be blocked")
+	}
+	if len(reported) != 1 || reported[0] != "10.0.0.1" {
+		t.Errorf("Expected a single report for 10.0.0.1; Got %v", reported)
+	}
+
+	// tracking more clients than MaxClients forgets the least recent one
+	guard.fail("10.0.0.2")
+	guard.fail("10.0.0.3")
+	if guard.blocked("10.0.0.1") || guard.lru.Len() != 2 {
+		t.Errorf("Expected 10.0.0.1 to be evicted; Got %d tracked clients", guard.lru.Len())
+	}
+
+	guard.Window = time.Millisecond
+	for i := 0; i < 3; i++ {
+		guard.fail("10.0.0.4")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if guard.blocked("10.0.0.4") {
+		t.Errorf("Expected the block to end with the window")
+	}
+}
+
+func Test_EnumerationGuardRejectsCookies(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("my-secret-key"))
+	store := &PGStore{
+		Codecs:  codecs,
+		Options: &sessions.Options{Path: "/"},
+		guard:   newEnumerationGuard(EnumerationGuard{Threshold: 1}),
+	}
+	store.guard.fail("192.0.2.1")
+
+	encoded, err := securecookie.EncodeMulti("guarded-session", "42", codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:51234"
+	req.AddCookie(&http.Cookie{Name: "guarded-session", Value: encoded})
+	session, err := store.New(req, "guarded-session")
+	if err != ErrTooManyFailedLoads {
+		t.Errorf("Expected ErrTooManyFailedLoads; Got %v", err)
+	}
+	if !session.IsNew || session.ID != "" {
+		t.Errorf("Expected a new session; Got IsNew=%v, ID %q", session.IsNew, session.ID)
+	}
+}
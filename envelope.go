@@ -0,0 +1,94 @@
+package postgrestore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+)
+
+// KMSClient wraps and unwraps data keys with a master key that never leaves a key management
+// service.  Implementations typically call out to a cloud KMS; the store only ever hands them
+// freshly generated 32 byte data keys and the wrapped form it previously received.
+type KMSClient interface {
+	// Encrypt wraps a plaintext data key with the master key.
+	Encrypt(ctx context.Context, dataKey []byte) (wrappedKey []byte, err error)
+	// Decrypt unwraps a data key previously returned by Encrypt.
+	Decrypt(ctx context.Context, wrappedKey []byte) (dataKey []byte, err error)
+}
+
+// addDataKeyColumn adds the "data_key" column holding wrapped data keys, if it is missing.
+func (dbStore *PGStore) addDataKeyColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS data_key BYTEA;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add data_key column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// sealFor envelope encrypts the encoded data of session, unless Config.EncryptSession exempts
+// it.  It returns the values for the "data" and "data_key" columns; the data key is nil, stored
+// as NULL, for sessions kept in plain.  Plain data is returned as bytes like sealed data, since
+// bytea's text format would treat backslashes as escapes and cannot carry compressed data.
+func (dbStore *PGStore) sealFor(ctx context.Context, session *sessions.Session, encoded string) (data interface{}, wrappedKey interface{}, err error) {
+	if fn := dbStore.config.EncryptSession; fn != nil && !fn(session) {
+		return []byte(encoded), nil, nil
+	}
+	sealed, key, err := dbStore.seal(ctx, encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sealed, key, nil
+}
+
+// seal encrypts the encoded session data under a new random data key using AES-256-GCM, and
+// returns the ciphertext along with the data key wrapped by the KMS.
+func (dbStore *PGStore) seal(ctx context.Context, encoded string) (data []byte, wrappedKey []byte, err error) {
+	dataKey := make([]byte, 32)
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	if wrappedKey, err = dbStore.kms.Encrypt(ctx, dataKey); err != nil {
+		return nil, nil, fmt.Errorf("postgrestore: unable to wrap data key: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, []byte(encoded), nil), wrappedKey, nil
+}
+
+// open reverses seal: it unwraps the data key through the KMS and decrypts data with it.
+func (dbStore *PGStore) open(ctx context.Context, data []byte, wrappedKey []byte) (string, error) {
+	dataKey, err := dbStore.kms.Decrypt(ctx, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("postgrestore: unable to unwrap data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("postgrestore: encrypted session data is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
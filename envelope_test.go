@@ -0,0 +1,162 @@
+package postgrestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeKMS wraps data keys with a local AES-GCM master key.
+type fakeKMS struct {
+	master []byte
+	calls  int
+}
+
+func newFakeKMS() *fakeKMS {
+	master := make([]byte, 32)
+	rand.Read(master)
+	return &fakeKMS{master: master}
+}
+
+func (k *fakeKMS) Encrypt(ctx context.Context, dataKey []byte) ([]byte, error) {
+	k.calls++
+	gcm, err := newGCM(k.master)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	return gcm.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (k *fakeKMS) Decrypt(ctx context.Context, wrappedKey []byte) ([]byte, error) {
+	k.calls++
+	gcm, err := newGCM(k.master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return gcm.Open(nil, wrappedKey[:gcm.NonceSize()], wrappedKey[gcm.NonceSize():], nil)
+}
+
+func Test_EnvelopeSealOpen(t *testing.T) {
+	kms := newFakeKMS()
+	store := &PGStore{kms: kms}
+	ctx := context.Background()
+
+	data, wrappedKey, err := store.seal(ctx, "encoded-session-data")
+	if err != nil {
+		t.Fatalf("Error sealing: %v", err)
+	}
+	if bytes.Contains(data, []byte("encoded-session-data")) {
+		t.Errorf("Expected sealed data not to contain the plaintext")
+	}
+	plain, err := store.open(ctx, data, wrappedKey)
+	if err != nil {
+		t.Fatalf("Error opening: %v", err)
+	}
+	if plain != "encoded-session-data" {
+		t.Errorf("Expected encoded-session-data; Got %q", plain)
+	}
+	if kms.calls != 2 {
+		t.Errorf("Expected 2 KMS calls; Got %d", kms.calls)
+	}
+
+	data[len(data)-1] ^= 0xff
+	if _, err = store.open(ctx, data, wrappedKey); err == nil {
+		t.Errorf("Expected tampered data to fail to open")
+	}
+	other := &PGStore{kms: newFakeKMS()}
+	if _, err = other.open(ctx, data, wrappedKey); err == nil {
+		t.Errorf("Expected a different master key to fail to unwrap")
+	}
+}
+
+func Test_EnvelopeRoundTrip(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, KMS: newFakeKMS()})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	session, err := store.Get(req, "envelope-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = sessions.Save(req, rsp); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", rsp.Header().Get("Set-Cookie"))
+	if session, err = store.Get(req, "envelope-session"); err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session.IsNew || session.Values["foo"] != "bar" {
+		t.Errorf("Expected the saved session with foo=bar; Got %#v", session.Values)
+	}
+	if err = store.Delete(httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+}
+
+func Test_SelectiveEncryption(t *testing.T) {
+	cases := map[string]Config{
+		"codecs": {},
+		// plain JSON holds the backslash as is, so it must not be sent as text
+		"json":       {Serializer: JSONSerializer{}},
+		"compressed": {Compressor: GzipCompressor{}},
+	}
+	for name, cfg := range cases {
+		cfg.DSN = dbUrl
+		cfg.KeyPairs = [][]byte{[]byte("my-secret-key")}
+		cfg.KMS = newFakeKMS()
+		cfg.EncryptSession = func(session *sessions.Session) bool { return session.Values["sensitive"] == true }
+		store, err := New(cfg)
+		if err != nil {
+			t.Fatalf("%s: failed to open a database connection: %#v", name, err)
+		}
+		defer store.Close()
+
+		for _, sensitive := range []bool{true, false} {
+			req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+			session, err := store.New(req, "selective-session")
+			if err != nil {
+				t.Fatalf("%s: Error getting session: %v", name, err)
+			}
+			session.Values["sensitive"] = sensitive
+			session.Values["path"] = `C:\Users\n`
+			m := httptest.NewRecorder()
+			if err = store.Save(req, m, session); err != nil {
+				t.Fatalf("%s: Error saving session: %v", name, err)
+			}
+			defer store.Delete(httptest.NewRecorder(), session)
+
+			var encrypted bool
+			err = store.db.QueryRow("SELECT data_key IS NOT NULL FROM http_sessions WHERE id = $1;", session.ID).Scan(&encrypted)
+			if err != nil {
+				t.Fatalf("%s: Error reading data key: %v", name, err)
+			}
+			if encrypted != sensitive {
+				t.Errorf("%s: Expected encrypted=%v for sensitive=%v", name, sensitive, sensitive)
+			}
+
+			req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+			req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+			loaded, err := store.New(req, "selective-session")
+			if err != nil || loaded.IsNew || loaded.Values["sensitive"] != sensitive || loaded.Values["path"] != `C:\Users\n` {
+				t.Errorf("%s: Expected the session to round-trip; Got IsNew=%v, %v, %v", name, loaded.IsNew, loaded.Values, err)
+			}
+		}
+	}
+}
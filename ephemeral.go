@@ -0,0 +1,27 @@
+package postgrestore
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+)
+
+// createEphemeralSchema creates a schema with a random "test_" name for Config.EphemeralSchema
+// and returns its name.
+func createEphemeralSchema(db *sql.DB) (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	schema := "test_" + hex.EncodeToString(suffix)
+	if _, err := db.Exec("CREATE SCHEMA " + schema + ";"); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// dropEphemeralSchema drops a schema created by createEphemeralSchema, with everything in it.
+func dropEphemeralSchema(db *sql.DB, schema string) error {
+	_, err := db.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE;")
+	return err
+}
@@ -0,0 +1,169 @@
+package postgrestore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/gorilla/securecookie"
+	"github.com/lib/pq"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrStoreUnavailable is returned, wrapped around the underlying driver error, when the database
+// cannot be reached at all: the pool has been closed, a connection broke, or the server is
+// shutting down or refusing connections.  Middleware can test for it with errors.Is and answer
+// with 503 Service Unavailable rather than 500.
+var ErrStoreUnavailable = errors.New("postgrestore: session store unavailable")
+
+// ErrSessionExpired is returned by PeekByID for sessions past their expiry.  Get and New start a
+// new session instead.
+var ErrSessionExpired = errors.New("postgrestore: session expired")
+
+// ErrValueTooBig is returned by Save when the encoded session data is longer than
+// PGStore.MaxLength.  Nothing is written to the database.
+var ErrValueTooBig = errors.New("postgrestore: the value to store is too big")
+
+// CookieError is returned by Get and New with Config.StrictCookies when the session cookie
+// could not be decoded: it was tampered with, is garbage, or was signed with a key the store no
+// longer has.  A new session is returned along with it.
+type CookieError struct {
+	// Name is the name of the session, and of its cookie.
+	Name string
+	Err  error
+}
+
+// Error implements error.
+func (e *CookieError) Error() string {
+	return fmt.Sprintf("postgrestore: invalid cookie for session %q: %s", e.Name, e.Err.Error())
+}
+
+// Unwrap returns the decoding error.
+func (e *CookieError) Unwrap() error {
+	return e.Err
+}
+
+// errInvalidExpiry is returned by Save for a new session whose "expires_on" value is not a
+// time.Time.
+var errInvalidExpiry = errors.New(`postgrestore: session.Values["expires_on"] must be a time.Time`)
+
+// errSessionOversized is returned by load when Config.ResetOversized discards a session whose
+// stored data exceeds the codecs' MaxLength.
+var errSessionOversized = errors.New("postgrestore: stored session data is too long to decode")
+
+// isDecodeTooLong reports whether err, as returned by securecookie.DecodeMulti, was caused by the
+// encoded value exceeding a codec's MaxLength.  securecookie only reports this through the
+// error message.
+func isDecodeTooLong(err error) bool {
+	errs := []error{err}
+	if multi, ok := err.(securecookie.MultiError); ok {
+		errs = multi
+	}
+	for _, e := range errs {
+		if e != nil && strings.Contains(e.Error(), "the value is too long") {
+			return true
+		}
+	}
+	return false
+}
+
+// encodedTooLong returns the length of the encoded value if err, as returned by
+// securecookie.EncodeMulti, was caused by the primary codec's MaxLength.  securecookie reports
+// the length only as a suffix of the error message.
+func encodedTooLong(err error) (int, bool) {
+	if multi, ok := err.(securecookie.MultiError); ok && len(multi) > 0 {
+		err = multi[0]
+	}
+	if err == nil {
+		return 0, false
+	}
+	const prefix = "the value is too long: "
+	msg := err.Error()
+	i := strings.Index(msg, prefix)
+	if i < 0 {
+		return 0, false
+	}
+	n, convErr := strconv.Atoi(msg[i+len(prefix):])
+	return n, convErr == nil
+}
+
+// classify wraps err in ErrStoreUnavailable when it indicates the database cannot be reached,
+// and returns it unchanged otherwise.
+func classify(err error) error {
+	if isUnavailable(err) {
+		return fmt.Errorf("%w: %w", ErrStoreUnavailable, err)
+	}
+	return err
+}
+
+// isUnavailable reports whether err means the database is unreachable, as opposed to a problem
+// with the query or the data.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrStoreUnavailable) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	if code := pqCode(err); code != "" {
+		switch code {
+		case "57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03", // cannot_connect_now
+			"53300": // too_many_connections
+			return true
+		}
+		// class 08 - connection exception
+		return strings.HasPrefix(code, "08")
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// database/sql does not export the error returned once the pool has been closed
+	msg := err.Error()
+	return strings.Contains(msg, "sql: database is closed") || strings.Contains(msg, "driver: bad connection")
+}
+
+// notSent reports whether err shows that a failed statement never reached the server, so that
+// running it again cannot apply it twice: the pool was closed, or no connection could be
+// established.  driver.ErrBadConn does not qualify, since lib/pq also reports a connection lost
+// while waiting for the reply with it.
+func notSent(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sql.ErrConnDone) || strings.Contains(err.Error(), "sql: database is closed") {
+		return true
+	}
+	switch pqCode(err) {
+	case "57P03", // cannot_connect_now
+		"53300", // too_many_connections
+		"08001", // sqlclient_unable_to_establish_sqlconnection
+		"08004": // sqlserver_rejected_establishment_of_sqlconnection
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// sqlStater is implemented by the errors of drivers other than lib/pq, such as pgx's
+// *pgconn.PgError.
+type sqlStater interface {
+	SQLState() string
+}
+
+// pqCode returns the SQLSTATE code of err if it is a Postgres error, or "" otherwise.
+func pqCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var stater sqlStater
+	if errors.As(err, &stater) {
+		return stater.SQLState()
+	}
+	return ""
+}
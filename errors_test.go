@@ -0,0 +1,123 @@
+package postgrestore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/gorilla/securecookie"
+	"github.com/lib/pq"
+	"net"
+	"strings"
+	"testing"
+)
+
+func Test_NotSent(t *testing.T) {
+	tests := []struct {
+		err     error
+		notSent bool
+	}{
+		{errors.New("sql: database is closed"), true},
+		{sql.ErrConnDone, true},
+		{&pq.Error{Code: "57P03"}, true},
+		{fmt.Errorf("wrapped: %w", &pq.Error{Code: "08001"}), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{nil, false},
+		{driver.ErrBadConn, false},
+		{&pq.Error{Code: "57P01"}, false},
+		{&pq.Error{Code: "08006"}, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, false},
+	}
+	for _, test := range tests {
+		if notSent(test.err) != test.notSent {
+			t.Errorf("Expected notSent(%#v) to be %t", test.err, test.notSent)
+		}
+	}
+}
+
+func Test_IsUnavailable(t *testing.T) {
+	unavailable := []error{
+		errors.New("sql: database is closed"),
+		errors.New("driver: bad connection"),
+		driver.ErrBadConn,
+		sql.ErrConnDone,
+		fmt.Errorf("wrapped: %w", driver.ErrBadConn),
+		&pq.Error{Code: "57P01"},
+		&pq.Error{Code: "08006"},
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+	}
+	for _, err := range unavailable {
+		if !isUnavailable(err) {
+			t.Errorf("Expected %#v to be classified as unavailable", err)
+		}
+		if !errors.Is(classify(err), ErrStoreUnavailable) {
+			t.Errorf("Expected classify(%v) to wrap ErrStoreUnavailable", err)
+		}
+	}
+
+	available := []error{
+		nil,
+		sql.ErrNoRows,
+		ErrSessionExpired,
+		&pq.Error{Code: "42P01"},
+	}
+	for _, err := range available {
+		if isUnavailable(err) {
+			t.Errorf("Expected %#v not to be classified as unavailable", err)
+		}
+		if classify(err) != err {
+			t.Errorf("Expected classify(%v) to return the error unchanged", err)
+		}
+	}
+}
+
+func Test_IsDecodeTooLong(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("my-secret-key"))
+	encoded, err := securecookie.EncodeMulti("session-key", strings.Repeat("x", 1000), codecs...)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	codecs[0].(*securecookie.SecureCookie).MaxLength(100)
+	var value string
+	err = securecookie.DecodeMulti("session-key", encoded, &value, codecs...)
+	if !isDecodeTooLong(err) {
+		t.Errorf("Expected %v to be classified as too long", err)
+	}
+	err = securecookie.DecodeMulti("session-key", "garbage", &value, codecs...)
+	if err == nil || isDecodeTooLong(err) {
+		t.Errorf("Expected %v not to be classified as too long", err)
+	}
+}
+
+func Test_EncodedTooLong(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("my-secret-key"))
+	codecs[0].(*securecookie.SecureCookie).MaxLength(100)
+	_, err := securecookie.EncodeMulti("session-key", strings.Repeat("x", 1000), codecs...)
+	if n, ok := encodedTooLong(err); !ok || n <= 1000 {
+		t.Errorf("Expected the encoded length to be reported; Got %d, %v from %v", n, ok, err)
+	}
+	if _, ok := encodedTooLong(errors.New("something else")); ok {
+		t.Errorf("Expected an unrelated error not to be classified as too long")
+	}
+}
+
+func Test_PqCode(t *testing.T) {
+	if code := pqCode(fmt.Errorf("wrapped: %w", &pq.Error{Code: "42501"})); code != "42501" {
+		t.Errorf("Expected 42501; Got %q", code)
+	}
+	if code := pqCode(fmt.Errorf("wrapped: %w", stateError("57P01"))); code != "57P01" {
+		t.Errorf("Expected 57P01 from another driver's error; Got %q", code)
+	}
+	if !isUnavailable(stateError("08006")) {
+		t.Errorf("Expected another driver's connection exception to be classified as unavailable")
+	}
+	if code := pqCode(sql.ErrNoRows); code != "" {
+		t.Errorf("Expected no code; Got %q", code)
+	}
+}
+
+// stateError mimics the errors of drivers such as pgx, which expose their code with SQLState.
+type stateError string
+
+func (e stateError) Error() string    { return "ERROR (SQLSTATE " + string(e) + ")" }
+func (e stateError) SQLState() string { return string(e) }
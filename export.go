@@ -0,0 +1,127 @@
+package postgrestore
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// exportBatchSize is the number of rows ExportAll fetches from its cursor at a time.
+const exportBatchSize = 500
+
+// maxImportLine bounds the length of a single line read by ImportAll.
+const maxImportLine = 16 << 20
+
+// ExportRecord is one line of the newline-delimited JSON written by ExportAll.  Data is the raw
+// stored session data, as returned by ExportRaw, and is base64 encoded in JSON.
+type ExportRecord struct {
+	ID         string    `json:"id"`
+	CreatedOn  time.Time `json:"created_on"`
+	ModifiedOn time.Time `json:"modified_on"`
+	ExpiresOn  time.Time `json:"expires_on"`
+	Data       []byte    `json:"data"`
+	DataKey    []byte    `json:"data_key,omitempty"`
+}
+
+// ExportAll writes every stored session, oldest first, to w as newline-delimited JSON
+// ExportRecords, e.g. to archive the store in object storage.  Rows are read through a
+// server-side cursor in batches, so memory use stays bounded however large the table is.  Unlike
+// other operations an export is never retried after a reconnect, since part of it may already
+// have been written.  The export does not hold up other operations on the store, however slowly
+// w consumes it; a pool rebuilt meanwhile ends it with an error.
+func (dbStore *PGStore) ExportAll(ctx context.Context, w io.Writer) error {
+	// only take the pool under the lock: a writer waiting for it would stall every other reader
+	dbStore.mu.RLock()
+	db := dbStore.db
+	dbStore.mu.RUnlock()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return classify(err)
+	}
+	defer tx.Rollback()
+	dataKey := "NULL::BYTEA"
+	if dbStore.kms != nil {
+		dataKey = "data_key"
+	}
+	query := fmt.Sprintf("DECLARE http_sessions_export NO SCROLL CURSOR FOR "+
+		"SELECT id, created_on, modified_on, expires_on, data, %s FROM %s WHERE data <> ''%s ORDER BY id;",
+		dataKey, dbStore.table, dbStore.tenantCondition(1))
+	if _, err = tx.ExecContext(ctx, query, dbStore.tenantArgs()...); err != nil {
+		return classify(err)
+	}
+	enc := json.NewEncoder(w)
+	for {
+		n, err := exportBatch(ctx, tx, enc)
+		if err != nil {
+			return classify(err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// exportBatch fetches the next batch from the export cursor and encodes it.  It returns the number
+// of rows written.
+func exportBatch(ctx context.Context, tx *sql.Tx, enc *json.Encoder) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH %d FROM http_sessions_export;", exportBatchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var rec ExportRecord
+		if err = rows.Scan(&rec.ID, &rec.CreatedOn, zeroIfNull{&rec.ModifiedOn}, &rec.ExpiresOn, &rec.Data, &rec.DataKey); err != nil {
+			return n, err
+		}
+		if err = enc.Encode(rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// ImportAll reads newline-delimited JSON ExportRecords from r, as written by ExportAll, and
+// inserts each as a new session with ImportRaw.  Sessions get new IDs.  Lines that cannot be
+// parsed or imported are passed to onError, with their 1-based line number, and skipped; with a
+// nil onError the import stops at the first bad line.  An unavailable database always stops the
+// import.  It returns the number of sessions imported.
+func (dbStore *PGStore) ImportAll(ctx context.Context, r io.Reader, onError func(line int, err error)) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+	imported, line := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec ExportRecord
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err == nil {
+			_, err = dbStore.ImportRaw(ctx, rec.Data, RawMetadata{
+				CreatedOn:  rec.CreatedOn,
+				ModifiedOn: rec.ModifiedOn,
+				ExpiresOn:  rec.ExpiresOn,
+				DataKey:    rec.DataKey,
+			})
+		}
+		if err != nil {
+			if onError == nil || isUnavailable(err) || ctx.Err() != nil {
+				return imported, fmt.Errorf("line %d: %w", line, err)
+			}
+			onError(line, err)
+			continue
+		}
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return imported, nil
+}
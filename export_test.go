@@ -0,0 +1,135 @@
+package postgrestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ExportImportAll(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "exported-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	var buf bytes.Buffer
+	if err = store.ExportAll(ctx, &buf); err != nil {
+		t.Fatalf("Error exporting sessions: %v", err)
+	}
+	var exported *ExportRecord
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var rec ExportRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Error parsing export line: %v", err)
+		}
+		if rec.ID == session.ID {
+			exported = &rec
+		}
+	}
+	if exported == nil {
+		t.Fatalf("Expected session %s in the export", session.ID)
+	}
+
+	line, _ := json.Marshal(exported)
+	input := "not json\n" + string(line) + "\n"
+	var badLines []int
+	n, err := store.ImportAll(ctx, strings.NewReader(input), func(line int, err error) {
+		badLines = append(badLines, line)
+	})
+	if err != nil {
+		t.Fatalf("Error importing sessions: %v", err)
+	}
+	if n != 1 || len(badLines) != 1 || badLines[0] != 1 {
+		t.Errorf("Expected 1 import and line 1 reported; Got %d, %v", n, badLines)
+	}
+	var id string
+	err = store.db.QueryRow("SELECT id FROM http_sessions WHERE data = $1 AND id <> $2;", exported.Data, session.ID).Scan(&id)
+	if err != nil {
+		t.Fatalf("Expected the imported row; Got %v", err)
+	}
+	defer store.stmtDelete.Exec(id)
+	imported, err := store.PeekByID(ctx, "exported-session", id)
+	if err != nil || imported.Values["foo"] != "bar" {
+		t.Errorf("Expected the imported session to decode; Got %v, %v", imported, err)
+	}
+
+	if _, err = store.ImportAll(ctx, strings.NewReader("{broken\n"), nil); err == nil {
+		t.Errorf("Expected an error without an error callback")
+	}
+}
+
+// blockingWriter signals its first Write on started and then waits for release.
+type blockingWriter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.started:
+	default:
+		close(w.started)
+		<-w.release
+	}
+	return len(p), nil
+}
+
+func Test_ExportAllDoesNotHoldLock(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "export-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	w := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() { done <- store.ExportAll(context.Background(), w) }()
+	<-w.started
+
+	// a writer, such as a pool rebuild, gets the lock while the export waits for w
+	locked := make(chan struct{})
+	go func() {
+		store.mu.Lock()
+		store.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the export not to hold the store's lock while streaming")
+	}
+	close(w.release)
+	if err = <-done; err != nil {
+		t.Errorf("Error exporting sessions: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package postgrestore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+)
+
+// FieldEncryptor encrypts selected session.Values entries with AES-GCM before the session data is
+// encoded, using a key separate from the cookie keys.  Operators who can decode the session data
+// with the cookie keys still only see ciphertext for the protected keys.  Every ciphertext is
+// bound to the key it is stored under, so it cannot be moved to another key, e.g. to have an
+// unprotected key display it.  It is not bound to the session ID, which a SERIAL table only
+// assigns after the data has been encoded.
+type FieldEncryptor struct {
+	key       []byte
+	protected map[string]bool
+}
+
+// encryptedField replaces a protected value in the encoded session data.
+type encryptedField struct {
+	Ciphertext []byte
+}
+
+// NewFieldEncryptor returns a FieldEncryptor for the given session.Values keys.  key must be 16,
+// 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewFieldEncryptor(key []byte, protectedKeys ...string) (*FieldEncryptor, error) {
+	if _, err := newGCM(key); err != nil {
+		return nil, err
+	}
+	protected := make(map[string]bool, len(protectedKeys))
+	for _, k := range protectedKeys {
+		protected[k] = true
+	}
+	return &FieldEncryptor{key: key, protected: protected}, nil
+}
+
+// encrypt returns a copy of values in which every protected key holds an encryptedField.
+func (fe *FieldEncryptor) encrypt(values map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	out := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		if name, ok := k.(string); ok && fe.protected[name] {
+			sealed, err := fe.seal(name, v)
+			if err != nil {
+				return nil, err
+			}
+			v = sealed
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// decrypt replaces every encryptedField in values with the value it protects.  Fields are
+// decrypted even if their key is no longer protected, so keys can be dropped from the set.
+func (fe *FieldEncryptor) decrypt(values map[interface{}]interface{}) error {
+	for k, v := range values {
+		if sealed, ok := v.(encryptedField); ok {
+			name, _ := k.(string)
+			plain, err := fe.open(name, sealed)
+			if err != nil {
+				return err
+			}
+			values[k] = plain
+		}
+	}
+	return nil
+}
+
+// seal encrypts value with the name of its key as additional data.
+func (fe *FieldEncryptor) seal(name string, value interface{}) (encryptedField, error) {
+	var buf bytes.Buffer
+	// wrap the value so gob records its concrete type
+	if err := gob.NewEncoder(&buf).Encode([]interface{}{value}); err != nil {
+		return encryptedField{}, err
+	}
+	gcm, err := newGCM(fe.key)
+	if err != nil {
+		return encryptedField{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return encryptedField{}, err
+	}
+	return encryptedField{Ciphertext: gcm.Seal(nonce, nonce, buf.Bytes(), []byte(name))}, nil
+}
+
+// open decrypts a value sealed under the key name.
+func (fe *FieldEncryptor) open(name string, sealed encryptedField) (interface{}, error) {
+	gcm, err := newGCM(fe.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("postgrestore: encrypted field is truncated")
+	}
+	nonce, ciphertext := sealed.Ciphertext[:gcm.NonceSize()], sealed.Ciphertext[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		// sealed before values were bound to their key; re-sealed with it on the next save
+		plain, err = gcm.Open(nil, nonce, ciphertext, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var value []interface{}
+	if err = gob.NewDecoder(bytes.NewReader(plain)).Decode(&value); err != nil {
+		return nil, err
+	}
+	if len(value) != 1 {
+		return nil, errors.New("postgrestore: malformed encrypted field")
+	}
+	return value[0], nil
+}
+
+func init() {
+	gob.Register(encryptedField{})
+}
@@ -0,0 +1,66 @@
+package postgrestore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"testing"
+)
+
+func Test_FieldEncryptor(t *testing.T) {
+	fe, err := NewFieldEncryptor(bytes.Repeat([]byte("k"), 32), "ssn")
+	if err != nil {
+		t.Fatalf("Error creating encryptor: %v", err)
+	}
+	store := &PGStore{
+		Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		config: Config{FieldEncryptor: fe},
+	}
+	session := sessions.NewSession(store, "field-session")
+	session.Values["ssn"] = "123-45-6789"
+	session.Values["theme"] = "dark-mode"
+
+	encoded, err := store.encodeValues(session)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	// securecookie produces base64("date|base64(gob)|mac") when no block key is set
+	raw, _ := base64.URLEncoding.DecodeString(encoded)
+	raw, _ = base64.URLEncoding.DecodeString(string(bytes.SplitN(raw, []byte("|"), 3)[1]))
+	if bytes.Contains(raw, []byte("123-45-6789")) {
+		t.Errorf("Expected the protected value to be encrypted in the encoded data")
+	}
+	if !bytes.Contains(raw, []byte("dark-mode")) {
+		t.Errorf("Expected unprotected values to stay readable")
+	}
+	if session.Values["ssn"] != "123-45-6789" {
+		t.Errorf("Expected session.Values to be left untouched")
+	}
+
+	values := map[interface{}]interface{}{}
+	if err = securecookie.DecodeMulti("field-session", encoded, &values, store.Codecs...); err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if err = fe.decrypt(values); err != nil {
+		t.Fatalf("Error decrypting: %v", err)
+	}
+	if values["ssn"] != "123-45-6789" || values["theme"] != "dark-mode" {
+		t.Errorf("Expected the values to round trip; Got %#v", values)
+	}
+
+	other, _ := NewFieldEncryptor(bytes.Repeat([]byte("x"), 32), "ssn")
+	sealed, _ := fe.encrypt(map[interface{}]interface{}{"ssn": "secret"})
+	if err = other.decrypt(sealed); err == nil {
+		t.Errorf("Expected decryption with another key to fail")
+	}
+	// a ciphertext moved to another key no longer decrypts
+	moved, _ := fe.encrypt(map[interface{}]interface{}{"ssn": "secret"})
+	moved["theme"], moved["ssn"] = moved["ssn"], nil
+	if err = fe.decrypt(moved); err == nil {
+		t.Errorf("Expected a ciphertext moved to another key to fail decryption; Got %#v", moved)
+	}
+	if _, err = NewFieldEncryptor([]byte("short"), "ssn"); err == nil {
+		t.Errorf("Expected an error for an invalid key size")
+	}
+}
@@ -0,0 +1,60 @@
+package postgrestore
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// FingerprintStrictness controls what happens when the fingerprint of a request does not match
+// the fingerprint stored with the session it presents.
+type FingerprintStrictness int
+
+const (
+	// FingerprintOff only records fingerprints.
+	FingerprintOff FingerprintStrictness = iota
+	// FingerprintWarn logs mismatches but still loads the session.
+	FingerprintWarn
+	// FingerprintEnforce treats a mismatching session as invalid, so a new one is started.
+	FingerprintEnforce
+)
+
+// errFingerprintMismatch is returned by load when FingerprintEnforce rejects a session.
+var errFingerprintMismatch = errors.New("postgrestore: device fingerprint mismatch")
+
+// addFingerprintColumn adds the "fingerprint" column if it is missing.
+func (dbStore *PGStore) addFingerprintColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS fingerprint TEXT;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add fingerprint column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// fingerprint hashes the caller-supplied fingerprint of r.  Only the hash is ever stored.
+func (dbStore *PGStore) fingerprint(r *http.Request) string {
+	sum := sha256.Sum256([]byte(dbStore.config.Fingerprint(r)))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkFingerprint compares the fingerprint of r with the one stored for session and applies the
+// configured strictness.  Sessions stored before fingerprinting was enabled are always accepted.
+func (dbStore *PGStore) checkFingerprint(r *http.Request, id string, stored sql.NullString) error {
+	if !stored.Valid || r == nil || dbStore.config.FingerprintStrictness == FingerprintOff {
+		return nil
+	}
+	if stored.String == dbStore.fingerprint(r) {
+		return nil
+	}
+	switch dbStore.config.FingerprintStrictness {
+	case FingerprintWarn:
+		dbStore.logger.Printf("Device fingerprint mismatch for session %s", dbStore.redact(id))
+	case FingerprintEnforce:
+		dbStore.logger.Printf("Rejecting session %s due to a device fingerprint mismatch", dbStore.redact(id))
+		return errFingerprintMismatch
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package postgrestore
+
+import (
+	"bytes"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_FingerprintStrictness(t *testing.T) {
+	var logs bytes.Buffer
+	store, err := New(Config{
+		DSN:         dbUrl,
+		KeyPairs:    [][]byte{[]byte("my-secret-key")},
+		Fingerprint: func(r *http.Request) string { return r.UserAgent() },
+		Logger:      log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Set("User-Agent", "browser-a")
+	rsp := httptest.NewRecorder()
+	session, err := store.New(req, "fingerprint-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+	cookie := rsp.Header().Get("Set-Cookie")
+
+	load := func(userAgent string) *sessions.Session {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Add("Cookie", cookie)
+		session, err := store.New(req, "fingerprint-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		return session
+	}
+
+	tests := []struct {
+		strictness FingerprintStrictness
+		loaded     bool
+		logged     bool
+	}{
+		{FingerprintOff, true, false},
+		{FingerprintWarn, true, true},
+		{FingerprintEnforce, false, true},
+	}
+	for _, test := range tests {
+		logs.Reset()
+		store.config.FingerprintStrictness = test.strictness
+		if session := load("browser-a"); session.IsNew {
+			t.Errorf("strictness %d: expected the matching device to load the session", test.strictness)
+		}
+		session := load("browser-b")
+		if loaded := !session.IsNew && session.Values["foo"] == "bar"; loaded != test.loaded {
+			t.Errorf("strictness %d: expected loaded=%t; Got %t", test.strictness, test.loaded, loaded)
+		}
+		if logged := strings.Contains(logs.String(), "fingerprint mismatch"); logged != test.logged {
+			t.Errorf("strictness %d: expected logged=%t; Got %q", test.strictness, test.logged, logs.String())
+		}
+	}
+}
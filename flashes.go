@@ -0,0 +1,120 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// defaultFlashKey is the key gorilla/sessions uses for flashes when none is given.
+const defaultFlashKey = "_flash"
+
+// errFlashTableDisabled is returned by the flash methods when the store was built without
+// Config.FlashTable.
+var errFlashTableDisabled = errors.New("postgrestore: the flash table is not enabled for this store")
+
+// createFlashTable creates the flash table, "http_session_flashes" by default, if it is missing.
+// Flashes are removed along with the session they belong to.
+func (dbStore *PGStore) createFlashTable() error {
+	flashes := dbStore.companionName("flashes")
+	_, err := dbStore.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"id BIGSERIAL PRIMARY KEY,"+
+		"session_id %s NOT NULL REFERENCES %s (id) ON DELETE CASCADE,"+
+		"key TEXT NOT NULL,"+
+		"data TEXT NOT NULL,"+
+		"created_on TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP);", flashes, dbStore.config.IDType.referenceType(), dbStore.table))
+	if err == nil {
+		_, err = dbStore.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_session_idx "+
+			"ON %[1]s (session_id, key);", flashes))
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to create %s table in the database: %s", flashes, err.Error())
+	}
+	return nil
+}
+
+// trimFlashes drops the oldest flashes beyond Config.MaxFlashes from values, a copy of the
+// session values about to be encoded.  The trimmed flashes are still a []interface{}, as
+// session.Flashes expects.
+func (dbStore *PGStore) trimFlashes(id string, values map[interface{}]interface{}) {
+	for _, key := range append([]string{defaultFlashKey}, dbStore.config.FlashKeys...) {
+		flashes, ok := values[key].([]interface{})
+		if !ok || len(flashes) <= dbStore.config.MaxFlashes {
+			continue
+		}
+		dropped := len(flashes) - dbStore.config.MaxFlashes
+		values[key] = append([]interface{}(nil), flashes[dropped:]...)
+		dbStore.logger.Printf("Dropped the %d oldest %q flashes of session %s", dropped, key, dbStore.redact(id))
+	}
+}
+
+// AddFlash appends a flash message to a saved session with a single INSERT, without rewriting
+// the session data.  Like sessions.Session.AddFlash the key defaults to "_flash".  Flashes added
+// this way are only returned by ConsumeFlashes, not by session.Flashes.
+func (dbStore *PGStore) AddFlash(ctx context.Context, session *sessions.Session, value interface{}, vars ...string) error {
+	if !dbStore.config.FlashTable {
+		return errFlashTableDisabled
+	}
+	key := flashKey(vars)
+	// wrap the value so gob records its concrete type
+	encoded, err := securecookie.EncodeMulti(session.Name(), []interface{}{value}, dbStore.Codecs...)
+	if err != nil {
+		return err
+	}
+	err = dbStore.withReconnectWrite(func() error {
+		_, err := dbStore.db.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (session_id, key, data) VALUES ($1, $2, $3);", dbStore.companionName("flashes")),
+			session.ID, key, encoded)
+		return err
+	})
+	return classify(err)
+}
+
+// ConsumeFlashes returns, oldest first, and removes the flash messages added to session with
+// AddFlash under the given key.
+func (dbStore *PGStore) ConsumeFlashes(ctx context.Context, session *sessions.Session, vars ...string) ([]interface{}, error) {
+	if !dbStore.config.FlashTable {
+		return nil, errFlashTableDisabled
+	}
+	key := flashKey(vars)
+	var encoded []string
+	err := dbStore.withReconnectWrite(func() error {
+		encoded = nil
+		rows, err := dbStore.db.QueryContext(ctx,
+			fmt.Sprintf("WITH consumed AS (DELETE FROM %s WHERE session_id = $1 AND key = $2 RETURNING id, data) "+
+				"SELECT data FROM consumed ORDER BY id;", dbStore.companionName("flashes")), session.ID, key)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var data string
+			if err = rows.Scan(&data); err != nil {
+				return err
+			}
+			encoded = append(encoded, data)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	var flashes []interface{}
+	for _, data := range encoded {
+		var value []interface{}
+		if err = securecookie.DecodeMulti(session.Name(), data, &value, dbStore.Codecs...); err != nil {
+			return nil, err
+		}
+		flashes = append(flashes, value...)
+	}
+	return flashes, nil
+}
+
+func flashKey(vars []string) string {
+	if len(vars) > 0 {
+		return vars[0]
+	}
+	return defaultFlashKey
+}
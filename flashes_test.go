@@ -0,0 +1,90 @@
+package postgrestore
+
+import (
+	"bytes"
+	"context"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_FlashTable(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, FlashTable: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "flash-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	for _, flash := range []interface{}{"foo", &FlashMessage{42, "bar"}} {
+		if err = store.AddFlash(ctx, session, flash); err != nil {
+			t.Fatalf("Error adding flash: %v", err)
+		}
+	}
+	if err = store.AddFlash(ctx, session, "baz", "custom_key"); err != nil {
+		t.Fatalf("Error adding flash: %v", err)
+	}
+
+	flashes, err := store.ConsumeFlashes(ctx, session)
+	if err != nil {
+		t.Fatalf("Error consuming flashes: %v", err)
+	}
+	if len(flashes) != 2 || flashes[0] != "foo" || flashes[1].(FlashMessage).Type != 42 {
+		t.Errorf("Expected foo and FlashMessage 42; Got %#v", flashes)
+	}
+	if flashes, err = store.ConsumeFlashes(ctx, session); err != nil || len(flashes) != 0 {
+		t.Errorf("Expected dumped flashes; Got %v, %v", flashes, err)
+	}
+	if flashes, err = store.ConsumeFlashes(ctx, session, "custom_key"); err != nil || len(flashes) != 1 || flashes[0] != "baz" {
+		t.Errorf("Expected baz; Got %v, %v", flashes, err)
+	}
+}
+
+func Test_MaxFlashes(t *testing.T) {
+	codecs := securecookie.CodecsFromPairs([]byte("my-secret-key"))
+	var logged bytes.Buffer
+	store := &PGStore{Codecs: codecs, logger: log.New(&logged, "", 0), config: Config{MaxFlashes: 2, FlashKeys: []string{"errors"}}}
+	session := sessions.NewSession(store, "flash-session")
+	for _, flash := range []string{"one", "two", "three"} {
+		session.AddFlash(flash)
+		session.AddFlash(flash, "errors")
+		session.AddFlash(flash, "other")
+	}
+	encoded, err := store.encodeValues(session)
+	if err != nil {
+		t.Fatalf("Error encoding session: %v", err)
+	}
+	if len(session.Flashes()) != 3 {
+		t.Errorf("Expected session.Values to be left alone")
+	}
+
+	loaded := sessions.NewSession(store, "flash-session")
+	if err = securecookie.DecodeMulti("flash-session", encoded, &loaded.Values, codecs...); err != nil {
+		t.Fatalf("Error decoding session: %v", err)
+	}
+	for _, key := range []string{"_flash", "errors"} {
+		if flashes := loaded.Flashes(key); len(flashes) != 2 || flashes[0] != "two" || flashes[1] != "three" {
+			t.Errorf("Expected the newest two %s flashes; Got %v", key, flashes)
+		}
+	}
+	if flashes := loaded.Flashes("other"); len(flashes) != 3 {
+		t.Errorf("Expected unlisted keys to keep their flashes; Got %v", flashes)
+	}
+	if !strings.Contains(logged.String(), "Dropped the 1 oldest") {
+		t.Errorf("Expected the trimming to be logged; Got %q", logged.String())
+	}
+}
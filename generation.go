@@ -0,0 +1,59 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errSessionRevoked is returned by load for sessions created before the last
+// BumpGlobalGeneration.
+var errSessionRevoked = errors.New("postgrestore: session revoked by a global logout")
+
+// errGlobalGenerationDisabled is returned by BumpGlobalGeneration when the store was built
+// without Config.GlobalGeneration.
+var errGlobalGenerationDisabled = errors.New("postgrestore: the global generation is not enabled for this store")
+
+// addGenerationColumn creates the single-row generation table, "http_session_generation" by
+// default, holding the current generation and adds the "global_generation" column to the
+// sessions table, if they are missing.  The column defaults to the current generation, read by a
+// function of the same name as the table, so every way of inserting a session, including
+// ReserveID and ImportRaw, stamps new rows without passing the value explicitly.
+func (dbStore *PGStore) addGenerationColumn() error {
+	generation := dbStore.companionName("generation")
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+			"id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),"+
+			"generation BIGINT NOT NULL DEFAULT 0);", generation),
+		fmt.Sprintf("INSERT INTO %s (id) VALUES (TRUE) ON CONFLICT DO NOTHING;", generation),
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %[1]s() RETURNS BIGINT LANGUAGE SQL STABLE "+
+			"AS 'SELECT generation FROM %[1]s';", generation),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS global_generation BIGINT NOT NULL "+
+			"DEFAULT %s();", dbStore.table, generation),
+	} {
+		if _, err := dbStore.db.Exec(stmt); err != nil {
+			return fmt.Errorf("Unable to add global_generation column to the %s table: %s", dbStore.table, err.Error())
+		}
+	}
+	return nil
+}
+
+// BumpGlobalGeneration invalidates every existing session at once, e.g. after a key compromise,
+// without deleting rows or rotating keys first.  Sessions created afterwards are unaffected.  It
+// returns the new generation.
+func (dbStore *PGStore) BumpGlobalGeneration(ctx context.Context) (int64, error) {
+	if !dbStore.config.GlobalGeneration {
+		return 0, errGlobalGenerationDisabled
+	}
+	var generation int64
+	err := dbStore.withReconnectWrite(func() error {
+		return dbStore.db.QueryRowContext(ctx,
+			fmt.Sprintf("UPDATE %s SET generation = generation + 1 RETURNING generation;",
+				dbStore.companionName("generation"))).Scan(&generation)
+	})
+	if err != nil {
+		return 0, classify(err)
+	}
+	dbStore.logger.Printf("Bumped the global session generation to %d, all older sessions are revoked", generation)
+	return generation, nil
+}
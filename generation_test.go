@@ -0,0 +1,61 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_BumpGlobalGeneration(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, GlobalGeneration: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "generation-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	m := httptest.NewRecorder()
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+
+	loaded, err := store.New(req, "generation-session")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the session to load; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+
+	if _, err = store.BumpGlobalGeneration(context.Background()); err != nil {
+		t.Fatalf("Error bumping the generation: %v", err)
+	}
+	loaded, err = store.New(req, "generation-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if !loaded.IsNew || loaded.Values["foo"] != nil {
+		t.Errorf("Expected the session to be revoked; Got %v", loaded.Values)
+	}
+
+	// sessions created after the bump are valid
+	fresh, err := store.New(httptest.NewRequest("GET", "http://localhost:8080/", nil), "generation-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	m = httptest.NewRecorder()
+	if err = store.Save(req, m, fresh); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), fresh)
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	if loaded, err = store.New(req, "generation-session"); err != nil || loaded.IsNew {
+		t.Errorf("Expected a post-bump session to load; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+}
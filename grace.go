@@ -0,0 +1,29 @@
+package postgrestore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errSessionDeleted is returned by load for sessions deleted within the grace window.
+var errSessionDeleted = errors.New("postgrestore: session has been deleted")
+
+// addDeleteAfterColumn adds the "delete_after" column if it is missing.
+func (dbStore *PGStore) addDeleteAfterColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS delete_after TIMESTAMPTZ;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add delete_after column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// deleteQuery returns the statement Delete runs.  With a grace window the row is only marked
+// for deletion; marking it again does not extend the window.
+func (dbStore *PGStore) deleteQuery() string {
+	if dbStore.config.GraceDeleteWindow <= 0 {
+		return fmt.Sprintf("DELETE FROM %s WHERE id = $1%s;", dbStore.table, dbStore.tenantCondition(2))
+	}
+	return fmt.Sprintf("UPDATE %s SET delete_after = now() + interval '%d milliseconds' "+
+		"WHERE id = $1 AND delete_after IS NULL%s;", dbStore.table, dbStore.config.GraceDeleteWindow.Milliseconds(),
+		dbStore.tenantCondition(2))
+}
@@ -0,0 +1,51 @@
+package postgrestore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_GraceDeleteWindow(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, GraceDeleteWindow: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "grace-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	m := httptest.NewRecorder()
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	id := session.ID
+	defer store.db.Exec("DELETE FROM http_sessions WHERE id = $1;", id)
+	if err = store.Delete(httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+
+	// the row is kept for the grace window ...
+	var deleteAfter time.Time
+	if err = store.db.QueryRow("SELECT delete_after FROM http_sessions WHERE id = $1;", id).Scan(&deleteAfter); err != nil {
+		t.Fatalf("Expected the row to be kept; Got %v", err)
+	}
+	if until := time.Until(deleteAfter); until < 59*time.Minute || until > 61*time.Minute {
+		t.Errorf("Expected delete_after about an hour from now; Got %s", deleteAfter)
+	}
+
+	// ... but the session no longer loads
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	loaded, err := store.New(req, "grace-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if !loaded.IsNew || loaded.Values["foo"] != nil {
+		t.Errorf("Expected a grace-deleted session to be treated as logged out; Got %v", loaded.Values)
+	}
+}
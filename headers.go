@@ -0,0 +1,60 @@
+package postgrestore
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrHeadersWritten is returned by Save and WriteCookie when Config.DetectWrittenHeaders is set
+// and the response headers have already been sent, so the session cookie would be dropped.
+var ErrHeadersWritten = errors.New("postgrestore: response headers already written, session cookie would be dropped")
+
+// HeaderWriteReporter is implemented by response writers that know whether the response headers
+// have been sent.  TrackHeaders wraps any http.ResponseWriter into one.
+type HeaderWriteReporter interface {
+	HeaderWritten() bool
+}
+
+// TrackHeaders wraps w so that it reports whether the response headers have been sent, for use
+// with Config.DetectWrittenHeaders.
+func TrackHeaders(w http.ResponseWriter) http.ResponseWriter {
+	return &headerTracker{ResponseWriter: w}
+}
+
+// headerTracker records the first WriteHeader or Write call on the wrapped writer.
+type headerTracker struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (t *headerTracker) WriteHeader(code int) {
+	t.written = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *headerTracker) Write(b []byte) (int, error) {
+	t.written = true
+	return t.ResponseWriter.Write(b)
+}
+
+// HeaderWritten reports whether the response headers have been sent.
+func (t *headerTracker) HeaderWritten() bool {
+	return t.written
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (t *headerTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// checkHeaders returns ErrHeadersWritten if detection is enabled and w reports that its headers
+// have been sent.  Writers that cannot tell are always accepted.
+func (dbStore *PGStore) checkHeaders(w http.ResponseWriter) error {
+	if !dbStore.config.DetectWrittenHeaders {
+		return nil
+	}
+	if reporter, ok := w.(HeaderWriteReporter); ok && reporter.HeaderWritten() {
+		return ErrHeadersWritten
+	}
+	return nil
+}
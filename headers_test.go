@@ -0,0 +1,71 @@
+package postgrestore
+
+import (
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_DetectWrittenHeaders(t *testing.T) {
+	store := &PGStore{
+		config: Config{DetectWrittenHeaders: true},
+		Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key")),
+	}
+	session := sessions.NewSession(store, "headers-session")
+	session.ID = "1"
+
+	w := TrackHeaders(httptest.NewRecorder())
+	if err := store.WriteCookie(w, session); err != nil {
+		t.Fatalf("Expected the cookie to be written before the body; Got %v", err)
+	}
+	w.Write([]byte("body"))
+	if err := store.WriteCookie(w, session); err != ErrHeadersWritten {
+		t.Errorf("Expected ErrHeadersWritten; Got %v", err)
+	}
+
+	// writers that cannot report their state are always accepted
+	recorder := httptest.NewRecorder()
+	recorder.WriteHeader(200)
+	if err := store.WriteCookie(recorder, session); err != nil {
+		t.Errorf("Expected plain writers to be accepted; Got %v", err)
+	}
+
+	store.config.DetectWrittenHeaders = false
+	if err := store.WriteCookie(w, session); err != nil {
+		t.Errorf("Expected detection to be off by default; Got %v", err)
+	}
+}
+
+func Test_ExpiringSaveHeaders(t *testing.T) {
+	store := &PGStore{
+		config: Config{DetectWrittenHeaders: true},
+		Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key")),
+	}
+	session := sessions.NewSession(store, "headers-session")
+	session.Options = &sessions.Options{Path: "/", MaxAge: -1}
+	session.IsNew = true
+
+	// the cookie expiring a session is checked like any other
+	w := TrackHeaders(httptest.NewRecorder())
+	w.Write([]byte("body"))
+	if err := store.Save(nil, w, session); err != ErrHeadersWritten {
+		t.Errorf("Expected ErrHeadersWritten; Got %v", err)
+	}
+
+	// and deferred like any other
+	store.DeferCookies = true
+	recorder := httptest.NewRecorder()
+	if err := store.Save(nil, recorder, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if cookies, ok := recorder.Header()["Set-Cookie"]; ok {
+		t.Errorf("Expected no cookies with DeferCookies; Got %v", cookies)
+	}
+	if err := store.WriteCookie(recorder, session); err != nil {
+		t.Fatalf("Error writing cookie: %v", err)
+	}
+	if cookie := recorder.Result().Cookies(); len(cookie) != 1 || cookie[0].MaxAge >= 0 {
+		t.Errorf("Expected WriteCookie to expire the cookie; Got %v", cookie)
+	}
+}
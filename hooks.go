@@ -0,0 +1,50 @@
+package postgrestore
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Hooks are called after the store's database operations on single sessions, e.g. to feed
+// Prometheus counters and histograms.  Each receives the session ID, how long the statement
+// took, and its error, if any; a load of a missing or reserved session reports sql.ErrNoRows.
+// The ID passed to OnInsert is the new session's, or "" if the insert failed.  Nil hooks are
+// skipped.  Hooks run synchronously on the request path, so they should be quick.
+type Hooks struct {
+	OnLoad   func(id string, d time.Duration, err error)
+	OnInsert func(id string, d time.Duration, err error)
+	OnUpdate func(id string, d time.Duration, err error)
+	OnDelete func(id string, d time.Duration, err error)
+
+	// OnDBError is called once for every database error a load, insert, update, delete or
+	// cleanup ends with, after retries, with op naming the operation: "load", "insert",
+	// "update", "delete" or "cleanup".  Sessions that are simply not found are not errors.
+	// It runs in its own goroutine, so a slow error tracker never holds up the operation.
+	OnDBError func(op string, err error)
+
+	// OnSessionCapReached is called with the client address whenever a new session is refused
+	// because of Config.MaxSessionsPerIP, e.g. to block the address upstream.
+	OnSessionCapReached func(ip string)
+
+	// OnCleanup is called after every successful Cleanup, CleanupTenant or background sweep with
+	// the number of rows removed and how long the statement took, e.g. to track table churn.
+	OnCleanup func(removed int64, took time.Duration)
+}
+
+// observe calls hook, if set, for the operation op on the session id that started at start,
+// and reports err to OnDBError.
+func (dbStore *PGStore) observe(op string, hook func(id string, d time.Duration, err error), id string, start time.Time, err error) {
+	if hook != nil {
+		hook(id, time.Since(start), err)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		dbStore.reportDBError(op, err)
+	}
+}
+
+// reportDBError hands err to Hooks.OnDBError, if set, without waiting for it.
+func (dbStore *PGStore) reportDBError(op string, err error) {
+	if onDBError := dbStore.config.Hooks.OnDBError; onDBError != nil {
+		go onDBError(op, err)
+	}
+}
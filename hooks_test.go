@@ -0,0 +1,123 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Hooks(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string][]string{}
+	record := func(op string) func(id string, d time.Duration, err error) {
+		return func(id string, d time.Duration, err error) {
+			if err != nil {
+				t.Errorf("Expected %s to succeed; Got %v", op, err)
+			}
+			mu.Lock()
+			calls[op] = append(calls[op], id)
+			mu.Unlock()
+		}
+	}
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Hooks: Hooks{
+		OnLoad:   record("load"),
+		OnInsert: record("insert"),
+		OnUpdate: record("update"),
+		OnDelete: record("delete"),
+	}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.Get(req, "hooks-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = session.Save(req, m); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	session, err = store.Get(req, "hooks-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if err = store.Delete(httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+
+	for _, op := range []string{"insert", "load", "update", "delete"} {
+		if ids := calls[op]; len(ids) != 1 || ids[0] != session.ID {
+			t.Errorf("Expected one %s of session %s; Got %v", op, session.ID, ids)
+		}
+	}
+}
+
+func Test_OnDBError(t *testing.T) {
+	reported := make(chan string, 4)
+	store := &PGStore{config: Config{Hooks: Hooks{OnDBError: func(op string, err error) {
+		reported <- op + ": " + err.Error()
+	}}}}
+	store.observe("load", nil, "1", time.Now(), sql.ErrNoRows)
+	store.observe("update", nil, "1", time.Now(), nil)
+	store.observe("delete", nil, "1", time.Now(), errors.New("connection reset"))
+	select {
+	case got := <-reported:
+		if got != "delete: connection reset" {
+			t.Errorf("Expected the delete error; Got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected OnDBError to be called")
+	}
+	select {
+	case got := <-reported:
+		t.Errorf("Expected a single report; Got %q as well", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_OnCleanup(t *testing.T) {
+	var calls []int64
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Hooks: Hooks{
+		OnCleanup: func(removed int64, took time.Duration) {
+			if took <= 0 {
+				t.Errorf("Expected a positive duration; Got %s", took)
+			}
+			calls = append(calls, removed)
+		},
+	}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "hooks-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["expires_on"] = time.Now().Add(-time.Minute)
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	removed, err := store.Cleanup(context.Background())
+	if err != nil {
+		t.Fatalf("Error cleaning up: %v", err)
+	}
+	if len(calls) != 1 || calls[0] != removed || removed < 1 {
+		t.Errorf("Expected one OnCleanup call with %d removed rows; Got %v", removed, calls)
+	}
+}
@@ -0,0 +1,45 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errSessionIdle is returned by load when a session has not been accessed within IdleTimeout.
+var errSessionIdle = errors.New("postgrestore: session idle timeout exceeded")
+
+// addLastAccessedColumn adds the "last_accessed_at" column if it is missing.
+func (dbStore *PGStore) addLastAccessedColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS last_accessed_at TIMESTAMPTZ;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add last_accessed_at column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// checkIdle rejects sessions that were last accessed longer than IdleTimeout ago.  Rows stored
+// before the idle timeout was enabled have no access time and are accepted.
+func (dbStore *PGStore) checkIdle(id string, lastAccessedAt sql.NullTime) error {
+	if !lastAccessedAt.Valid {
+		return nil
+	}
+	if idle := time.Since(lastAccessedAt.Time); idle > dbStore.config.IdleTimeout {
+		dbStore.logger.Printf("Session %s has been idle for %s, longer than %s.", dbStore.redact(id), idle, dbStore.config.IdleTimeout)
+		return errSessionIdle
+	}
+	return nil
+}
+
+// touch records that the session with the given ID has just been accessed.
+func (dbStore *PGStore) touch(ctx context.Context, id string) error {
+	err := dbStore.withReconnect(func() error {
+		_, err := dbStore.db.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET last_accessed_at = $1 WHERE id = $2%s;", dbStore.table, dbStore.tenantCondition(3)),
+			append([]interface{}{time.Now(), id}, dbStore.tenantArgs()...)...)
+		return err
+	})
+	return classify(err)
+}
@@ -0,0 +1,60 @@
+package postgrestore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_IdleTimeout(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, IdleTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "idle-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	m := httptest.NewRecorder()
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+
+	setLastAccess := func(ago time.Duration) {
+		_, err := store.db.Exec("UPDATE http_sessions SET last_accessed_at = $1 WHERE id = $2;", time.Now().Add(-ago), session.ID)
+		if err != nil {
+			t.Fatalf("Error setting last access: %v", err)
+		}
+	}
+
+	// just inside the idle window the session loads and its access time is refreshed
+	setLastAccess(time.Minute - 5*time.Second)
+	loaded, err := store.New(req, "idle-session")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the session to load; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+	var lastAccessedAt time.Time
+	if err = store.db.QueryRow("SELECT last_accessed_at FROM http_sessions WHERE id = $1;", session.ID).Scan(&lastAccessedAt); err != nil {
+		t.Fatalf("Error reading last access: %v", err)
+	}
+	if time.Since(lastAccessedAt) > 5*time.Second {
+		t.Errorf("Expected last_accessed_at to be refreshed; Got %s", lastAccessedAt)
+	}
+
+	// past the idle window a new session is started
+	setLastAccess(time.Minute + 5*time.Second)
+	loaded, err = store.New(req, "idle-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if !loaded.IsNew || loaded.Values["foo"] != nil {
+		t.Errorf("Expected an idle session to be reset; Got %v", loaded.Values)
+	}
+}
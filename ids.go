@@ -0,0 +1,83 @@
+package postgrestore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDType selects the type of the sessions table's primary key.
+type IDType string
+
+const (
+	// IDTypeSerial numbers sessions with a SERIAL column, unique within one table.  It is the
+	// default.
+	IDTypeSerial IDType = "serial"
+	// IDTypeUUID keys sessions with random version 4 UUIDs generated by the store, so IDs stay
+	// unique when sessions are federated across databases.
+	IDTypeUUID IDType = "uuid"
+)
+
+// columnType returns the definition of the id column of a new sessions table.
+func (t IDType) columnType() string {
+	if t == IDTypeUUID {
+		return "UUID PRIMARY KEY"
+	}
+	return "SERIAL PRIMARY KEY"
+}
+
+// referenceType returns the type of columns referencing the sessions table's id.
+func (t IDType) referenceType() string {
+	if t == IDTypeUUID {
+		return "UUID"
+	}
+	return "INTEGER"
+}
+
+// valid reports whether id can be an ID of this type, in a form PostgreSQL accepts: a 32-bit
+// integer, or a UUID in its canonical form or as 32 bare hex digits.  Looking up anything else
+// fails the whole statement.
+func (t IDType) valid(id string) bool {
+	if t != IDTypeUUID {
+		_, err := strconv.ParseInt(id, 10, 32)
+		return err == nil
+	}
+	if len(id) == 36 {
+		if id[8] != '-' || id[13] != '-' || id[18] != '-' || id[23] != '-' {
+			return false
+		}
+		id = strings.ReplaceAll(id, "-", "")
+	}
+	_, err := hex.DecodeString(id)
+	return len(id) == 32 && err == nil
+}
+
+// newUUID returns a random version 4 UUID in its canonical text form.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// newRow adds the columns the store fills in for every new row to the columns and arguments of
+// an INSERT: the tenant, if any, and the id when the store generates the IDs; SERIAL tables
+// assign them themselves.
+func (dbStore *PGStore) newRow(cols []string, args []interface{}) ([]string, []interface{}, error) {
+	if dbStore.config.Tenant != "" {
+		cols, args = append(cols, "tenant"), append(args, dbStore.config.Tenant)
+	}
+	if dbStore.config.IDType != IDTypeUUID {
+		return cols, args, nil
+	}
+	id, err := newUUID()
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(cols, "id"), append(args, id), nil
+}
@@ -0,0 +1,85 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func Test_NewUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := newUUID()
+		if err != nil {
+			t.Fatalf("Error generating UUID: %v", err)
+		}
+		if !pattern.MatchString(id) || seen[id] {
+			t.Errorf("Expected a fresh version 4 UUID; Got %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func Test_IDTypeValid(t *testing.T) {
+	for id, expected := range map[string]bool{"42": true, "-1": true, "abc": false, "4294967296": false, "": false} {
+		if IDTypeSerial.valid(id) != expected {
+			t.Errorf("Expected serial ID %q to be valid: %v", id, expected)
+		}
+	}
+	for id, expected := range map[string]bool{
+		"3f9a0c1e-5b7d-4468-8a0c-1e5b7d24683f": true,
+		"3F9A0C1E5B7D44688A0C1E5B7D24683F":     true,
+		"3f9a0c1e5b7d-4468-8a0c-1e5b7d24683f-": false,
+		"42":                                   false,
+	} {
+		if IDTypeUUID.valid(id) != expected {
+			t.Errorf("Expected UUID %q to be valid: %v", id, expected)
+		}
+	}
+}
+
+func Test_UUIDIDs(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, IDType: IDTypeUUID, TableName: "uuid_sessions"})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.New(req, "uuid-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+	if len(session.ID) != 36 {
+		t.Errorf("Expected a UUID session ID; Got %s", session.ID)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	loaded, err := store.New(req, "uuid-session")
+	if err != nil || loaded.IsNew || loaded.Values["foo"] != "bar" {
+		t.Errorf("Expected the session to load; Got IsNew=%v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+
+	id, err := store.ReserveID(context.Background())
+	if err != nil {
+		t.Fatalf("Error reserving ID: %v", err)
+	}
+	defer store.DeleteByID(context.Background(), id)
+	if len(id) != 36 {
+		t.Errorf("Expected a UUID reservation; Got %s", id)
+	}
+	if _, err = store.PeekByID(context.Background(), "uuid-session", "42"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a serial ID; Got %v", err)
+	}
+}
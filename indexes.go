@@ -0,0 +1,64 @@
+package postgrestore
+
+import (
+	"context"
+	"fmt"
+)
+
+// IndexConfig selects the metadata columns that get a secondary index.  Every index speeds up
+// the queries filtering on its column at the cost of slower writes, so only the columns an
+// application actually queries should be indexed.
+type IndexConfig struct {
+	CreatedOn  bool
+	ModifiedOn bool
+	ExpiresOn  bool
+	// LastAccessedAt requires Config.IdleTimeout, which adds the column.
+	LastAccessedAt bool
+}
+
+// columns lists the columns selected by ic.
+func (ic IndexConfig) columns() []string {
+	var cols []string
+	if ic.CreatedOn {
+		cols = append(cols, "created_on")
+	}
+	if ic.ModifiedOn {
+		cols = append(cols, "modified_on")
+	}
+	if ic.ExpiresOn {
+		cols = append(cols, "expires_on")
+	}
+	if ic.LastAccessedAt {
+		cols = append(cols, "last_accessed_at")
+	}
+	return cols
+}
+
+// EnsureIndexes creates the index on expires_on, which the cleanup sweep relies on, and the
+// indexes selected by Config.Indexes that do not exist yet.  Tables created by the store get the
+// expires_on index from the start; for older tables calling EnsureIndexes once migrates them in
+// place.  Calling it again is harmless.  Indexes that are no longer selected are left in place.
+func (dbStore *PGStore) EnsureIndexes(ctx context.Context) error {
+	cols := dbStore.config.Indexes.columns()
+	if !dbStore.config.Indexes.ExpiresOn {
+		cols = append(cols, "expires_on")
+	}
+	return dbStore.ensureIndexes(ctx, cols)
+}
+
+// ensureIndexes creates an index on each of cols unless it exists.  New only creates the
+// selected ones, so that starting a new version does not build an unrequested index on a large
+// table, which blocks writes while it runs.
+func (dbStore *PGStore) ensureIndexes(ctx context.Context, cols []string) error {
+	for _, col := range cols {
+		err := dbStore.withReconnect(func() error {
+			_, err := dbStore.db.ExecContext(ctx,
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s);", dbStore.indexName(col), dbStore.table, col))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to create index on %s.%s: %w", dbStore.table, col, classify(err))
+		}
+	}
+	return nil
+}
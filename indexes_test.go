@@ -0,0 +1,80 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func Test_EnsureIndexes(t *testing.T) {
+	indexes := IndexConfig{ExpiresOn: true, LastAccessedAt: true}
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, IdleTimeout: 15 * time.Minute, Indexes: indexes})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	// a second call must be a no-op
+	if err = store.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("Error ensuring indexes: %v", err)
+	}
+	for _, name := range []string{"http_sessions_expires_on_idx", "http_sessions_last_accessed_at_idx"} {
+		var exists bool
+		err = store.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE tablename = 'http_sessions' AND indexname = $1);", name).Scan(&exists)
+		if err != nil {
+			t.Fatalf("Error looking up index: %v", err)
+		}
+		if !exists {
+			t.Errorf("Expected index %s to exist", name)
+		}
+	}
+}
+
+func Test_IndexConfigValidate(t *testing.T) {
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Indexes: IndexConfig{LastAccessedAt: true}}
+	if err := cfg.validate(); err == nil {
+		t.Errorf("Expected an error when indexing last_accessed_at without an idle timeout")
+	}
+}
+
+func Test_ExpiresOnIndex(t *testing.T) {
+	db, err := sql.Open(testDriver, dbUrl)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("DROP TABLE IF EXISTS indexed_sessions;"); err != nil {
+		t.Fatalf("Error dropping table: %v", err)
+	}
+	defer db.Exec("DROP TABLE IF EXISTS indexed_sessions;")
+
+	indexExists := func() bool {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE tablename = 'indexed_sessions' AND indexname = 'indexed_sessions_expires_on_idx');").Scan(&exists)
+		if err != nil {
+			t.Fatalf("Error looking up index: %v", err)
+		}
+		return exists
+	}
+
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "indexed_sessions"})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	if !indexExists() {
+		t.Fatalf("Expected a new table to be created with an index on expires_on")
+	}
+
+	// a table from before the index is migrated by EnsureIndexes
+	if _, err = db.Exec("DROP INDEX indexed_sessions_expires_on_idx;"); err != nil {
+		t.Fatalf("Error dropping index: %v", err)
+	}
+	if err = store.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("Error ensuring indexes: %v", err)
+	}
+	if !indexExists() {
+		t.Errorf("Expected EnsureIndexes to create the index on expires_on")
+	}
+}
@@ -0,0 +1,131 @@
+package postgrestore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errInvalidCursor is returned by ListSessions for cursors it did not issue.
+var errInvalidCursor = errors.New("postgrestore: invalid pagination cursor")
+
+// SessionMeta describes a stored session without its data.
+type SessionMeta struct {
+	ID         string
+	CreatedOn  time.Time
+	ModifiedOn time.Time
+	ExpiresOn  time.Time
+}
+
+// ListFilter narrows the sessions returned by ListSessions.
+type ListFilter func(q *listQuery)
+
+// listQuery collects the conditions contributed by ListFilters.
+type listQuery struct {
+	conds []string
+	args  []interface{}
+}
+
+// where adds a condition; each "?" in cond is replaced by the parameter bound to the matching arg.
+func (q *listQuery) where(cond string, args ...interface{}) {
+	for _, arg := range args {
+		q.args = append(q.args, arg)
+		cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(q.args)), 1)
+	}
+	q.conds = append(q.conds, cond)
+}
+
+// ActiveOnly lists only sessions that have not expired yet.
+func ActiveOnly() ListFilter {
+	return func(q *listQuery) {
+		q.where("expires_on > now()")
+	}
+}
+
+// Tagged lists only sessions carrying tag.  It requires Config.Tags.
+func Tagged(tag string) ListFilter {
+	return func(q *listQuery) {
+		q.where("tags @> ARRAY[?]::TEXT[]", tag)
+	}
+}
+
+// ListSessions returns up to limit sessions, oldest first, starting after cursor, along with the
+// cursor of the next page.  Pass an empty cursor for the first page; an empty next cursor means
+// there are no more sessions.  Pagination is keyed on (created_on, id) rather than an offset, so
+// pages stay stable while sessions are created or deleted in between requests.  Reservations
+// made by ReserveID are not listed.
+func (dbStore *PGStore) ListSessions(ctx context.Context, cursor string, limit int, filters ...ListFilter) ([]SessionMeta, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("postgrestore: ListSessions requires a positive limit")
+	}
+	q := &listQuery{}
+	q.where("data <> ''")
+	if dbStore.config.Tenant != "" {
+		q.where("tenant = ?", dbStore.config.Tenant)
+	}
+	if cursor != "" {
+		createdOn, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		q.where("(created_on, id) > (?, ?)", createdOn, id)
+	}
+	for _, filter := range filters {
+		filter(q)
+	}
+	q.args = append(q.args, limit+1)
+	query := fmt.Sprintf("SELECT id, created_on, modified_on, expires_on FROM %s WHERE %s "+
+		"ORDER BY created_on, id LIMIT $%d;", dbStore.table, strings.Join(q.conds, " AND "), len(q.args))
+
+	var items []SessionMeta
+	err := dbStore.withReconnect(func() error {
+		items = nil
+		rows, err := dbStore.db.QueryContext(ctx, query, q.args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var item SessionMeta
+			if err = rows.Scan(&item.ID, &item.CreatedOn, zeroIfNull{&item.ModifiedOn}, &item.ExpiresOn); err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, "", classify(err)
+	}
+	if len(items) <= limit {
+		return items, "", nil
+	}
+	items = items[:limit]
+	last := items[limit-1]
+	return items, encodeCursor(last.CreatedOn, last.ID), nil
+}
+
+// encodeCursor packs the position after a session into an opaque string.
+func encodeCursor(createdOn time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdOn.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+// decodeCursor unpacks a cursor returned by encodeCursor.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", errInvalidCursor
+	}
+	createdOn, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	return createdOn, id, nil
+}
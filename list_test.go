@@ -0,0 +1,83 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_ListSessions(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	var created []string
+	for i := 0; i < 5; i++ {
+		session, err := store.New(req, "listed-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		defer store.Delete(httptest.NewRecorder(), session)
+		created = append(created, session.ID)
+	}
+
+	// walk every page; the sessions created above must all show up exactly once, in order
+	seen := map[string]int{}
+	var order []string
+	cursor := ""
+	for {
+		items, next, err := store.ListSessions(ctx, cursor, 2, ActiveOnly())
+		if err != nil {
+			t.Fatalf("Error listing sessions: %v", err)
+		}
+		if len(items) > 2 {
+			t.Fatalf("Expected at most 2 items per page; Got %d", len(items))
+		}
+		for _, item := range items {
+			seen[item.ID]++
+			order = append(order, item.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	position := -1
+	for _, id := range created {
+		if seen[id] != 1 {
+			t.Errorf("Expected session %s to be listed once; Got %d", id, seen[id])
+		}
+		for i, listed := range order {
+			if listed == id {
+				if i < position {
+					t.Errorf("Expected session %s to be listed after its predecessors", id)
+				}
+				position = i
+			}
+		}
+	}
+
+	if _, _, err = store.ListSessions(ctx, "not-a-cursor", 2); err != errInvalidCursor {
+		t.Errorf("Expected errInvalidCursor; Got %v", err)
+	}
+}
+
+func Test_Cursor(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC)
+	createdOn, id, err := decodeCursor(encodeCursor(ts, "42"))
+	if err != nil {
+		t.Fatalf("Error decoding cursor: %v", err)
+	}
+	if id != "42" || !createdOn.Equal(ts) {
+		t.Errorf("Expected the cursor to round-trip; Got %s, %s", createdOn, id)
+	}
+}
@@ -0,0 +1,67 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+)
+
+// errLocaleColumnsDisabled is returned by ListByLocale when the store was built without
+// Config.LocaleColumns.
+var errLocaleColumnsDisabled = errors.New("postgrestore: locale columns are not enabled for this store")
+
+// addLocaleColumns adds the "locale" and "timezone" columns, and their indexes, if they are missing.
+func (dbStore *PGStore) addLocaleColumns() error {
+	for _, stmt := range []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS locale TEXT;", dbStore.table),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS timezone TEXT;", dbStore.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (locale);", dbStore.indexName("locale"), dbStore.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (timezone);", dbStore.indexName("timezone"), dbStore.table),
+	} {
+		if _, err := dbStore.db.Exec(stmt); err != nil {
+			return fmt.Errorf("Unable to add locale columns to the %s table: %s", dbStore.table, err.Error())
+		}
+	}
+	return nil
+}
+
+// localeArgs returns session.Values["locale"] and session.Values["timezone"] for the locale
+// columns.  Missing or non-string values are stored as NULL.
+func localeArgs(session *sessions.Session) []interface{} {
+	var locale, timezone sql.NullString
+	locale.String, locale.Valid = session.Values["locale"].(string)
+	timezone.String, timezone.Valid = session.Values["timezone"].(string)
+	return []interface{}{locale, timezone}
+}
+
+// ListByLocale returns the IDs of all unexpired sessions whose "locale" value is locale.
+func (dbStore *PGStore) ListByLocale(ctx context.Context, locale string) ([]string, error) {
+	if !dbStore.config.LocaleColumns {
+		return nil, errLocaleColumnsDisabled
+	}
+	var ids []string
+	err := dbStore.withReconnect(func() error {
+		ids = nil
+		rows, err := dbStore.db.QueryContext(ctx,
+			fmt.Sprintf("SELECT id FROM %s WHERE locale = $1 AND expires_on > now()%s ORDER BY id;", dbStore.table, dbStore.tenantCondition(2)),
+			append([]interface{}{locale}, dbStore.tenantArgs()...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return ids, nil
+}
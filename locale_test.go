@@ -0,0 +1,56 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_LocaleColumns(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, LocaleColumns: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "locale-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["locale"] = "de-CH"
+	session.Values["timezone"] = "Europe/Zurich"
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	ids, err := store.ListByLocale(ctx, "de-CH")
+	if err != nil {
+		t.Fatalf("Error listing by locale: %v", err)
+	}
+	if !containsID(ids, session.ID) {
+		t.Errorf("Expected %s in %v", session.ID, ids)
+	}
+
+	// updates keep the columns in sync
+	session.Values["locale"] = "fr-CH"
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if ids, err = store.ListByLocale(ctx, "de-CH"); err != nil {
+		t.Fatalf("Error listing by locale: %v", err)
+	}
+	if containsID(ids, session.ID) {
+		t.Errorf("Expected %s to have moved to fr-CH; Got %v", session.ID, ids)
+	}
+	var timezone string
+	if err = store.db.QueryRow("SELECT timezone FROM http_sessions WHERE id = $1;", session.ID).Scan(&timezone); err != nil {
+		t.Fatalf("Error reading timezone: %v", err)
+	}
+	if timezone != "Europe/Zurich" {
+		t.Errorf("Expected timezone Europe/Zurich; Got %q", timezone)
+	}
+}
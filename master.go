@@ -0,0 +1,70 @@
+package postgrestore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// Labels of the keys derived by DeriveKeyPair.  They are part of the derivation and must never
+// change, or every outstanding session becomes unreadable.
+const (
+	hashKeyInfo  = "postgrestore/securecookie/hash-key/v1"
+	blockKeyInfo = "postgrestore/securecookie/block-key/v1"
+)
+
+// minMasterLength is the shortest master secret DeriveKeyPair accepts.
+const minMasterLength = 32
+
+// DeriveKeyPair derives a securecookie hash key and block key from a single master secret, so
+// only one secret has to be managed while signing and encryption still use separate keys.  The
+// derivation is HKDF-SHA256 (RFC 5869) with an empty salt and the info labels
+// "postgrestore/securecookie/hash-key/v1" for the 64 byte hash key and
+// "postgrestore/securecookie/block-key/v1" for the 32 byte, AES-256, block key.  Every instance
+// given the same master derives the same keys.  master must be at least 32 bytes of
+// high-entropy secret material, not a password.
+//
+// To rotate, derive a pair from the new master and list it before the pair of the old one in
+// Config.KeyPairs.
+func DeriveKeyPair(master []byte) (hashKey, blockKey []byte, err error) {
+	if len(master) < minMasterLength {
+		return nil, nil, errors.New("postgrestore: the master secret must be at least 32 bytes long")
+	}
+	prk := hkdfExtract(nil, master)
+	return hkdfExpand(prk, hashKeyInfo, 64), hkdfExpand(prk, blockKeyInfo, 32), nil
+}
+
+// NewPostgreSQLStoreFromMaster creates a store like NewPostgreSQLStore, with the key pair
+// DeriveKeyPair derives from master.
+func NewPostgreSQLStoreFromMaster(dbUrl string, path string, maxAge int, master []byte) (*PGStore, error) {
+	hashKey, blockKey, err := DeriveKeyPair(master)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostgreSQLStore(dbUrl, path, maxAge, hashKey, blockKey)
+}
+
+// hkdfExtract is the extract step of HKDF-SHA256.  An empty salt stands for a block of zeros.
+func hkdfExtract(salt, secret []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// hkdfExpand is the expand step of HKDF-SHA256, producing length bytes for info.  length must not
+// exceed 255 blocks of output.
+func hkdfExpand(prk []byte, info string, length int) []byte {
+	var out, block []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		mac := hmac.New(sha256.New, prk)
+		mac.Write(block)
+		mac.Write([]byte(info))
+		mac.Write([]byte{counter})
+		block = mac.Sum(nil)
+		out = append(out, block...)
+	}
+	return out[:length]
+}
@@ -0,0 +1,52 @@
+package postgrestore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/gorilla/securecookie"
+	"testing"
+)
+
+func Test_HKDFVectors(t *testing.T) {
+	// RFC 5869, test cases 1 and 3
+	ikm := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm := hkdfExpand(hkdfExtract(salt, ikm), string(info), 42)
+	if got := hex.EncodeToString(okm); got != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865" {
+		t.Errorf("Unexpected output for test case 1: %s", got)
+	}
+	okm = hkdfExpand(hkdfExtract(nil, ikm), "", 42)
+	if got := hex.EncodeToString(okm); got != "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8" {
+		t.Errorf("Unexpected output for test case 3: %s", got)
+	}
+}
+
+func Test_DeriveKeyPair(t *testing.T) {
+	if _, _, err := DeriveKeyPair([]byte("too short")); err == nil {
+		t.Errorf("Expected a short master secret to be rejected")
+	}
+	master := bytes.Repeat([]byte("0123456789abcdef"), 2)
+	hashKey, blockKey, err := DeriveKeyPair(master)
+	if err != nil {
+		t.Fatalf("Error deriving keys: %v", err)
+	}
+	if len(hashKey) != 64 || len(blockKey) != 32 || bytes.Equal(hashKey[:32], blockKey) {
+		t.Errorf("Expected separate 64 and 32 byte keys; Got %d and %d bytes", len(hashKey), len(blockKey))
+	}
+	again, _, _ := DeriveKeyPair(master)
+	if !bytes.Equal(hashKey, again) {
+		t.Errorf("Expected the derivation to be reproducible")
+	}
+
+	// a cookie encoded by one instance decodes on another with the same master
+	encoded, err := securecookie.New(hashKey, blockKey).Encode("session", "42")
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	otherHash, otherBlock, _ := DeriveKeyPair(master)
+	var id string
+	if err = securecookie.New(otherHash, otherBlock).Decode("session", encoded, &id); err != nil || id != "42" {
+		t.Errorf("Expected the cookie to decode with the derived keys; Got %q, %v", id, err)
+	}
+}
@@ -0,0 +1,105 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// GetMulti loads the sessions with the given name and IDs in a single query, for listings and
+// admin views that would otherwise make one round trip per session.  The result is keyed by
+// session ID, as stored.  Like PeekByID it never writes to the session rows; sessions that are missing,
+// expired, idle, revoked or deleted are left out of the result rather than reported.  Only the
+// query is shared: every session's data is still decoded on its own by the codecs, or the
+// Serializer, so a long list costs as much CPU as loading the sessions one by one.
+func (dbStore *PGStore) GetMulti(ctx context.Context, name string, ids []string) (map[string]*sessions.Session, error) {
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		// an ID the column cannot hold would fail the query for all of them
+		if dbStore.config.IDType.valid(id) {
+			valid = append(valid, id)
+		}
+	}
+	result := make(map[string]*sessions.Session, len(valid))
+	if len(valid) == 0 {
+		return result, nil
+	}
+	// the IDs are bound as one text array literal, which lib/pq and pgx both pass through as is
+	query := fmt.Sprintf("SELECT id, %s FROM %s WHERE id = ANY($1::text[]::%s[])%s;",
+		strings.Join(dbStore.selectColumns(), ", "), dbStore.table, dbStore.config.IDType.referenceType(), dbStore.validityClause())
+	args := dbStore.selectArgs(arrayLiteral(valid))
+	type idRow struct {
+		id string
+		storedRow
+	}
+	var found []*idRow
+	readCtx, cancel := dbStore.readContext(ctx)
+	defer cancel()
+	err := dbStore.withReconnect(func() error {
+		found = found[:0]
+		rows, err := dbStore.db.QueryContext(readCtx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			row := &idRow{}
+			if err = rows.Scan(append([]interface{}{&row.id}, dbStore.scanDest(&row.storedRow)...)...); err != nil {
+				return err
+			}
+			found = append(found, row)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		err = classify(err)
+		dbStore.reportDBError("load", err)
+		return nil, err
+	}
+	for _, row := range found {
+		if row.encodedData == "" {
+			// an uncommitted reservation made by ReserveID
+			continue
+		}
+		session := sessions.NewSession(dbStore, name)
+		session.ID = row.id
+		opts := *dbStore.Options
+		session.Options = &opts
+		err = dbStore.restore(ctx, nil, session, &row.storedRow, true)
+		if errors.Is(err, ErrSessionExpired) || err == errSessionIdle || err == errSessionRevoked ||
+			err == errSessionDeleted || err == errSessionOversized || err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		session.IsNew = false
+		result[session.ID] = session
+	}
+	return result, nil
+}
+
+// arrayLiteral returns values as a PostgreSQL array literal, e.g. {"1","2"}, with every element
+// quoted.
+func arrayLiteral(values []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('"')
+		for _, c := range value {
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
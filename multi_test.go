@@ -0,0 +1,61 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_GetMulti(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	var ids []string
+	for _, value := range []string{"one", "two", "three"} {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		session, err := store.New(req, "multi-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		session.Values["value"] = value
+		if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		defer store.DeleteByID(context.Background(), session.ID)
+		ids = append(ids, session.ID)
+	}
+
+	loaded, err := store.GetMulti(context.Background(), "multi-session", append(ids, "0", "not-an-id"))
+	if err != nil {
+		t.Fatalf("Error loading sessions: %v", err)
+	}
+	if len(loaded) != 3 {
+		t.Fatalf("Expected 3 sessions; Got %d", len(loaded))
+	}
+	for i, value := range []string{"one", "two", "three"} {
+		session := loaded[ids[i]]
+		if session == nil || session.IsNew || session.Values["value"] != value {
+			t.Errorf("Expected session %s to hold %q; Got %v", ids[i], value, session)
+		}
+	}
+}
+
+func Test_ArrayLiteral(t *testing.T) {
+	tests := []struct {
+		values   []string
+		expected string
+	}{
+		{nil, `{}`},
+		{[]string{"1", "2"}, `{"1","2"}`},
+		{[]string{`a"b`, `c\d`, "e,f", "NULL"}, `{"a\"b","c\\d","e,f","NULL"}`},
+	}
+	for _, test := range tests {
+		if literal := arrayLiteral(test.values); literal != test.expected {
+			t.Errorf("Expected %s for %q; Got %s", test.expected, test.values, literal)
+		}
+	}
+}
@@ -0,0 +1,642 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Option configures a store built by NewPostgreSQLStoreWithOptions.  Every option sets one or
+// more Config fields, so anything reachable through a Config can also be expressed as an option.
+// New options follow the same shape: validate the argument, return a descriptive error if it is
+// unusable, and otherwise update the Config.
+type Option func(cfg *Config) error
+
+// NewPostgreSQLStoreWithOptions builds a store for the given database URL and key pairs, applying
+// opts in order.  Without options the cookie path is "/" and cookies expire with the browser
+// session.
+func NewPostgreSQLStoreWithOptions(dbUrl string, keyPairs [][]byte, opts ...Option) (*PGStore, error) {
+	cfg, err := configFromOptions(dbUrl, keyPairs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// configFromOptions applies opts to a Config holding dbUrl and keyPairs.
+func configFromOptions(dbUrl string, keyPairs [][]byte, opts ...Option) (Config, error) {
+	cfg := Config{
+		DSN:      dbUrl,
+		KeyPairs: keyPairs,
+		Options:  &sessions.Options{Path: "/"},
+	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+// WithPath sets the cookie path of new sessions.
+func WithPath(path string) Option {
+	return func(cfg *Config) error {
+		if path == "" {
+			return errors.New("postgrestore: WithPath requires a non-empty path")
+		}
+		cfg.Options.Path = path
+		return nil
+	}
+}
+
+// WithMaxAge sets the cookie MaxAge, in seconds, of new sessions.
+func WithMaxAge(maxAge int) Option {
+	return func(cfg *Config) error {
+		if maxAge < 0 {
+			return errors.New("postgrestore: WithMaxAge requires a non-negative max age")
+		}
+		cfg.Options.MaxAge = maxAge
+		return nil
+	}
+}
+
+// WithCookieOptions replaces the default cookie options of new sessions wholesale.  Options
+// applied afterwards, such as WithPath, modify the copy.  Each store gets its own copy, so the
+// Option can be reused.
+func WithCookieOptions(options sessions.Options) Option {
+	return func(cfg *Config) error {
+		opts := options
+		cfg.Options = &opts
+		return nil
+	}
+}
+
+// WithCookieOptionsFunc derives the cookie options of each session from the request; see
+// Config.CookieOptionsFunc.
+func WithCookieOptionsFunc(fn func(r *http.Request, base *sessions.Options) *sessions.Options) Option {
+	return func(cfg *Config) error {
+		if fn == nil {
+			return errors.New("postgrestore: WithCookieOptionsFunc requires a non-nil function")
+		}
+		cfg.CookieOptionsFunc = fn
+		return nil
+	}
+}
+
+// WithPool tunes the connection pool; see the corresponding Config fields.
+func WithPool(maxOpenConns, maxIdleConns int, connMaxLifetime time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.MaxOpenConns = maxOpenConns
+		cfg.MaxIdleConns = maxIdleConns
+		cfg.ConnMaxLifetime = connMaxLifetime
+		return nil
+	}
+}
+
+// WithWarmupConnections pre-populates the pool with n connections at construction; see
+// Config.WarmupConnections.
+func WithWarmupConnections(n int) Option {
+	return func(cfg *Config) error {
+		cfg.WarmupConnections = n
+		return nil
+	}
+}
+
+// WithStrictCookies reports undecodable session cookies as a *CookieError; see
+// Config.StrictCookies.
+func WithStrictCookies() Option {
+	return func(cfg *Config) error {
+		cfg.StrictCookies = true
+		return nil
+	}
+}
+
+// WithTruncateFunc sheds session data that would exceed MaxLength with truncate; see
+// Config.TruncateFunc.
+func WithTruncateFunc(truncate func(values map[interface{}]interface{}, overBy int)) Option {
+	return func(cfg *Config) error {
+		if truncate == nil {
+			return errors.New("postgrestore: WithTruncateFunc requires a non-nil function")
+		}
+		cfg.TruncateFunc = truncate
+		return nil
+	}
+}
+
+// WithLogger routes the store's diagnostic messages to logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(cfg *Config) error {
+		if logger == nil {
+			return errors.New("postgrestore: WithLogger requires a non-nil logger")
+		}
+		cfg.Logger = logger
+		return nil
+	}
+}
+
+// WithRedactor scrubs session IDs in log lines and errors; see Config.Redactor.
+func WithRedactor(redactor func(id string) string) Option {
+	return func(cfg *Config) error {
+		if redactor == nil {
+			return errors.New("postgrestore: WithRedactor requires a non-nil function")
+		}
+		cfg.Redactor = redactor
+		return nil
+	}
+}
+
+// WithCSRFSecrets enables per-session CSRF secrets; see PGStore.EnableCSRFSecrets.
+func WithCSRFSecrets() Option {
+	return func(cfg *Config) error {
+		cfg.CSRFSecrets = true
+		return nil
+	}
+}
+
+// WithDeferredCookies sets PGStore.DeferCookies.
+func WithDeferredCookies() Option {
+	return func(cfg *Config) error {
+		cfg.DeferCookies = true
+		return nil
+	}
+}
+
+// WithKMS enables envelope encryption of the stored session data; see Config.KMS.
+func WithKMS(kms KMSClient) Option {
+	return func(cfg *Config) error {
+		if kms == nil {
+			return errors.New("postgrestore: WithKMS requires a non-nil client")
+		}
+		cfg.KMS = kms
+		return nil
+	}
+}
+
+// WithSelectiveEncryption envelope encrypts only the sessions fn selects; see
+// Config.EncryptSession.  It requires WithKMS.
+func WithSelectiveEncryption(fn func(session *sessions.Session) bool) Option {
+	return func(cfg *Config) error {
+		if fn == nil {
+			return errors.New("postgrestore: WithSelectiveEncryption requires a non-nil function")
+		}
+		cfg.EncryptSession = fn
+		return nil
+	}
+}
+
+// WithTags enables session tagging; see Config.Tags.
+func WithTags() Option {
+	return func(cfg *Config) error {
+		cfg.Tags = true
+		return nil
+	}
+}
+
+// WithReconnect rebuilds the connection pool after fatal connection errors, waiting at least
+// backoff between rebuilds; see Config.Reconnect.
+func WithReconnect(backoff time.Duration) Option {
+	return func(cfg *Config) error {
+		if backoff < 0 {
+			return errors.New("postgrestore: WithReconnect requires a non-negative backoff")
+		}
+		cfg.Reconnect = true
+		cfg.ReconnectBackoff = backoff
+		return nil
+	}
+}
+
+// WithLegacyKeyPairs keeps sessions encoded with a previous scheme readable; see
+// PGStore.LegacyCodecs.
+func WithLegacyKeyPairs(keyPairs ...[]byte) Option {
+	return func(cfg *Config) error {
+		if len(keyPairs) == 0 {
+			return errors.New("postgrestore: WithLegacyKeyPairs requires at least one key")
+		}
+		cfg.LegacyKeyPairs = keyPairs
+		return nil
+	}
+}
+
+// WithKeyRotation re-encodes sessions stored under an old key pair when they are loaded; see
+// Config.KeyRotation.
+func WithKeyRotation() Option {
+	return func(cfg *Config) error {
+		cfg.KeyRotation = true
+		return nil
+	}
+}
+
+// WithDriverName opens the pool with the named database/sql driver; see Config.DriverName.
+func WithDriverName(name string) Option {
+	return func(cfg *Config) error {
+		cfg.DriverName = name
+		return nil
+	}
+}
+
+// WithCompressor compresses the stored session data with compressor, keeping data written with
+// any of the decompressors readable; see Config.Compressor.
+func WithCompressor(compressor Compressor, decompressors ...Compressor) Option {
+	return func(cfg *Config) error {
+		if compressor == nil {
+			return errors.New("postgrestore: WithCompressor requires a non-nil compressor")
+		}
+		cfg.Compressor = compressor
+		cfg.Decompressors = decompressors
+		return nil
+	}
+}
+
+// WithCookieCodec replaces the securecookie encoding of the session cookie; see CookieCodec.
+func WithCookieCodec(codec CookieCodec) Option {
+	return func(cfg *Config) error {
+		if codec == nil {
+			return errors.New("postgrestore: WithCookieCodec requires a non-nil codec")
+		}
+		cfg.CookieCodec = codec
+		return nil
+	}
+}
+
+// WithSerializer encodes the stored session data with serializer; see PGStore.Serializer.
+func WithSerializer(serializer Serializer) Option {
+	return func(cfg *Config) error {
+		if serializer == nil {
+			return errors.New("postgrestore: WithSerializer requires a non-nil serializer")
+		}
+		cfg.Serializer = serializer
+		return nil
+	}
+}
+
+// WithFingerprint binds sessions to the device fingerprint computed by fingerprint; see
+// Config.Fingerprint.
+func WithFingerprint(fingerprint func(r *http.Request) string, strictness FingerprintStrictness) Option {
+	return func(cfg *Config) error {
+		if fingerprint == nil {
+			return errors.New("postgrestore: WithFingerprint requires a non-nil function")
+		}
+		cfg.Fingerprint = fingerprint
+		cfg.FingerprintStrictness = strictness
+		return nil
+	}
+}
+
+// WithResetOversized starts over with a new session when stored data is too long to decode; see
+// Config.ResetOversized.
+func WithResetOversized() Option {
+	return func(cfg *Config) error {
+		cfg.ResetOversized = true
+		return nil
+	}
+}
+
+// WithTableName stores sessions in the named table; see Config.TableName.
+func WithTableName(name string) Option {
+	return func(cfg *Config) error {
+		if !tableNamePattern.MatchString(name) {
+			return errors.New("postgrestore: WithTableName requires a lower case identifier of at most 40 characters")
+		}
+		cfg.TableName = name
+		return nil
+	}
+}
+
+// WithIDType selects the primary key type of the sessions table; see Config.IDType.
+func WithIDType(idType IDType) Option {
+	return func(cfg *Config) error {
+		cfg.IDType = idType
+		return nil
+	}
+}
+
+// WithSchema keeps the session tables in the named schema; see Config.Schema.
+func WithSchema(schema string) Option {
+	return func(cfg *Config) error {
+		if !identifierPattern.MatchString(schema) {
+			return errors.New("postgrestore: WithSchema requires a lower case identifier")
+		}
+		cfg.Schema = schema
+		return nil
+	}
+}
+
+// WithEphemeralSchema keeps the session tables in a schema of their own that Close drops.  It is
+// meant for tests only; see Config.EphemeralSchema.
+func WithEphemeralSchema() Option {
+	return func(cfg *Config) error {
+		cfg.EphemeralSchema = true
+		return nil
+	}
+}
+
+// WithTimeouts sets the connect and statement timeouts; see Config.ConnectTimeout.  Zero leaves
+// a timeout unset.
+func WithTimeouts(connectTimeout, statementTimeout time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.ConnectTimeout = connectTimeout
+		cfg.StatementTimeout = statementTimeout
+		return nil
+	}
+}
+
+// WithOperationTimeouts bounds loads by read and saves and deletes by write; see
+// Config.ReadTimeout.  Zero leaves an operation class unbounded.
+func WithOperationTimeouts(read, write time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.ReadTimeout = read
+		cfg.WriteTimeout = write
+		return nil
+	}
+}
+
+// WithSearchPath sets the search_path of every pooled connection; see Config.SearchPath.
+func WithSearchPath(searchPath string) Option {
+	return func(cfg *Config) error {
+		if searchPath == "" {
+			return errors.New("postgrestore: WithSearchPath requires a search path")
+		}
+		cfg.SearchPath = searchPath
+		return nil
+	}
+}
+
+// WithRole sets the role of every pooled connection; see Config.Role.
+func WithRole(role string) Option {
+	return func(cfg *Config) error {
+		if role == "" {
+			return errors.New("postgrestore: WithRole requires a role name")
+		}
+		cfg.Role = role
+		return nil
+	}
+}
+
+// WithoutTimestamps keeps the load timestamps out of session.Values; see PGStore.InjectTimestamps.
+func WithoutTimestamps() Option {
+	return func(cfg *Config) error {
+		cfg.OmitTimestamps = true
+		return nil
+	}
+}
+
+// WithModifiedOnNull leaves modified_on NULL until the first update; see
+// Config.LeaveModifiedOnNull.
+func WithModifiedOnNull() Option {
+	return func(cfg *Config) error {
+		cfg.LeaveModifiedOnNull = true
+		return nil
+	}
+}
+
+// WithExpiryTolerance sets how long past its expiry a session is still loaded; see
+// Config.ExpiryTolerance.
+func WithExpiryTolerance(d time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.ExpiryTolerance = d
+		return nil
+	}
+}
+
+// WithRefreshExpiry slides the expiry forward on every Save; see Config.RefreshExpiry.
+func WithRefreshExpiry() Option {
+	return func(cfg *Config) error {
+		cfg.RefreshExpiry = true
+		return nil
+	}
+}
+
+// WithIdleTimeout expires sessions after d of inactivity; see Config.IdleTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(cfg *Config) error {
+		if d <= 0 {
+			return errors.New("postgrestore: WithIdleTimeout requires a positive duration")
+		}
+		cfg.IdleTimeout = d
+		return nil
+	}
+}
+
+// WithIndexes indexes the selected metadata columns; see Config.Indexes.
+func WithIndexes(indexes IndexConfig) Option {
+	return func(cfg *Config) error {
+		cfg.Indexes = indexes
+		return nil
+	}
+}
+
+// WithRevisions counts updates in a "revision" column; see Config.Revisions.
+func WithRevisions() Option {
+	return func(cfg *Config) error {
+		cfg.Revisions = true
+		return nil
+	}
+}
+
+// WithGlobalGeneration enables BumpGlobalGeneration; see Config.GlobalGeneration.
+func WithGlobalGeneration() Option {
+	return func(cfg *Config) error {
+		cfg.GlobalGeneration = true
+		return nil
+	}
+}
+
+// WithGraceDeleteWindow keeps deleted sessions for d before they are purged; see
+// Config.GraceDeleteWindow.
+func WithGraceDeleteWindow(d time.Duration) Option {
+	return func(cfg *Config) error {
+		if d <= 0 {
+			return errors.New("postgrestore: WithGraceDeleteWindow requires a positive duration")
+		}
+		cfg.GraceDeleteWindow = d
+		return nil
+	}
+}
+
+// WithCleanupInterval removes expired sessions in the background every interval until the store
+// is closed; see Config.CleanupInterval.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(cfg *Config) error {
+		if interval <= 0 {
+			return errors.New("postgrestore: WithCleanupInterval requires a positive interval")
+		}
+		cfg.CleanupInterval = interval
+		return nil
+	}
+}
+
+// WithLocaleColumns stores the session locale and timezone in their own columns; see
+// Config.LocaleColumns.
+func WithLocaleColumns() Option {
+	return func(cfg *Config) error {
+		cfg.LocaleColumns = true
+		return nil
+	}
+}
+
+// WithValidity only loads sessions satisfying the predicates; see Config.Validity.
+func WithValidity(predicates ...Predicate) Option {
+	return func(cfg *Config) error {
+		for _, p := range predicates {
+			if err := p.validate(); err != nil {
+				return err
+			}
+		}
+		cfg.Validity = append(cfg.Validity, predicates...)
+		return nil
+	}
+}
+
+// WithCreationContext stores what capture extracts from the request creating a session; see
+// Config.CreationContext.
+func WithCreationContext(capture func(r *http.Request) interface{}) Option {
+	return func(cfg *Config) error {
+		if capture == nil {
+			return errors.New("postgrestore: WithCreationContext requires a non-nil function")
+		}
+		cfg.CreationContext = capture
+		return nil
+	}
+}
+
+// WithEnumerationGuard rejects clients guessing session IDs; see Config.EnumerationGuard.
+func WithEnumerationGuard(guard EnumerationGuard) Option {
+	return func(cfg *Config) error {
+		if guard.Threshold <= 0 {
+			return errors.New("postgrestore: WithEnumerationGuard requires a positive threshold")
+		}
+		cfg.EnumerationGuard = guard
+		return nil
+	}
+}
+
+// WithMaxSessionsPerIP caps the unexpired sessions of one client address at max, counting those
+// created within window only if it is positive; see Config.MaxSessionsPerIP.
+func WithMaxSessionsPerIP(max int, window time.Duration) Option {
+	return func(cfg *Config) error {
+		if max <= 0 {
+			return errors.New("postgrestore: WithMaxSessionsPerIP requires a positive cap")
+		}
+		cfg.MaxSessionsPerIP = max
+		cfg.SessionCapWindow = window
+		return nil
+	}
+}
+
+// WithSearchScanLimit caps the number of sessions SearchByValue decodes in one call; 0 restores
+// the default.  See Config.SearchScanLimit.
+func WithSearchScanLimit(limit int) Option {
+	return func(cfg *Config) error {
+		if limit < 0 {
+			return errors.New("postgrestore: WithSearchScanLimit requires a limit of zero or more")
+		}
+		cfg.SearchScanLimit = limit
+		return nil
+	}
+}
+
+// WithTenant confines the store to the sessions of one tenant; see Config.Tenant.
+func WithTenant(tenant string) Option {
+	return func(cfg *Config) error {
+		if !tenantPattern.MatchString(tenant) {
+			return fmt.Errorf("postgrestore: WithTenant requires at most 63 lower case letters, digits, '.', '_', ':' or '-', got %q", tenant)
+		}
+		cfg.Tenant = tenant
+		return nil
+	}
+}
+
+// WithHooks calls hooks around the store's database operations; see Config.Hooks.
+func WithHooks(hooks Hooks) Option {
+	return func(cfg *Config) error {
+		cfg.Hooks = hooks
+		return nil
+	}
+}
+
+// WithEnrich adds the ephemeral keys set by enrich to every loaded session; see Config.Enrich.
+func WithEnrich(enrich func(ctx context.Context, session *sessions.Session) error, keys ...string) Option {
+	return func(cfg *Config) error {
+		if enrich == nil || len(keys) == 0 {
+			return errors.New("postgrestore: WithEnrich requires a non-nil function and at least one key")
+		}
+		cfg.Enrich = enrich
+		cfg.EnrichKeys = keys
+		return nil
+	}
+}
+
+// WithFlashTable stores server-side flashes in their own table; see Config.FlashTable.
+func WithFlashTable() Option {
+	return func(cfg *Config) error {
+		cfg.FlashTable = true
+		return nil
+	}
+}
+
+// WithMaxFlashes keeps at most max flashes per key in the stored data; see Config.MaxFlashes.
+func WithMaxFlashes(max int, keys ...string) Option {
+	return func(cfg *Config) error {
+		if max <= 0 {
+			return errors.New("postgrestore: WithMaxFlashes requires a positive maximum")
+		}
+		cfg.MaxFlashes = max
+		cfg.FlashKeys = keys
+		return nil
+	}
+}
+
+// WithWrittenHeaderDetection reports late calls to Save as errors; see Config.DetectWrittenHeaders.
+func WithWrittenHeaderDetection() Option {
+	return func(cfg *Config) error {
+		cfg.DetectWrittenHeaders = true
+		return nil
+	}
+}
+
+// WithExpiresHeader reports the session expiry in the named response header on Save; see
+// PGStore.ExpiresHeader.
+func WithExpiresHeader(name string) Option {
+	return func(cfg *Config) error {
+		if name == "" {
+			return errors.New("postgrestore: WithExpiresHeader requires a header name")
+		}
+		cfg.ExpiresHeader = name
+		return nil
+	}
+}
+
+// WithFieldEncryptor encrypts selected session.Values keys; see Config.FieldEncryptor.
+func WithFieldEncryptor(fe *FieldEncryptor) Option {
+	return func(cfg *Config) error {
+		if fe == nil {
+			return errors.New("postgrestore: WithFieldEncryptor requires a non-nil encryptor")
+		}
+		cfg.FieldEncryptor = fe
+		return nil
+	}
+}
+
+// WithReservationTTL sets how long reserved session IDs remain available; see
+// Config.ReservationTTL.
+func WithReservationTTL(ttl time.Duration) Option {
+	return func(cfg *Config) error {
+		if ttl <= 0 {
+			return errors.New("postgrestore: WithReservationTTL requires a positive duration")
+		}
+		cfg.ReservationTTL = ttl
+		return nil
+	}
+}
+
+// WithEnvironment picks the Secure and SameSite cookie attributes for env; see Config.Environment.
+func WithEnvironment(env Environment) Option {
+	return func(cfg *Config) error {
+		cfg.Environment = env
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package postgrestore
+
+import (
+	"github.com/gorilla/sessions"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_ConfigFromOptions(t *testing.T) {
+	keyPairs := [][]byte{[]byte("my-secret-key")}
+	logger := log.New(os.Stderr, "sessions: ", 0)
+	cfg, err := configFromOptions(dbUrl, keyPairs,
+		WithPath("/app"), WithMaxAge(3600), WithLogger(logger), WithCSRFSecrets())
+	if err != nil {
+		t.Fatalf("Error applying options: %v", err)
+	}
+	if cfg.Options.Path != "/app" || cfg.Options.MaxAge != 3600 {
+		t.Errorf("Expected path /app and max age 3600; Got %#v", cfg.Options)
+	}
+	if cfg.Logger != logger || !cfg.CSRFSecrets {
+		t.Errorf("Options were not applied: %#v", cfg)
+	}
+
+	if _, err = configFromOptions(dbUrl, keyPairs, WithMaxAge(-1)); err == nil {
+		t.Errorf("Expected an error for a negative max age")
+	}
+	if _, err = configFromOptions(dbUrl, keyPairs, WithPool(2, 5, 0)); err == nil {
+		t.Errorf("Expected an error for more idle than open connections")
+	}
+	if _, err = configFromOptions(dbUrl, nil, WithPath("/")); err == nil {
+		t.Errorf("Expected an error for missing key pairs")
+	}
+	if _, err = configFromOptions(dbUrl, keyPairs, WithCleanupInterval(0)); err == nil {
+		t.Errorf("Expected an error for a zero cleanup interval")
+	}
+}
+
+func Test_WithCookieOptionsReused(t *testing.T) {
+	keyPairs := [][]byte{[]byte("my-secret-key")}
+	cookieOptions := WithCookieOptions(sessions.Options{Path: "/", MaxAge: 3600})
+	first, err := configFromOptions(dbUrl, keyPairs, cookieOptions, WithPath("/first"))
+	if err != nil {
+		t.Fatalf("Error applying options: %v", err)
+	}
+	second, err := configFromOptions(dbUrl, keyPairs, cookieOptions, WithCleanupInterval(time.Minute))
+	if err != nil {
+		t.Fatalf("Error applying options: %v", err)
+	}
+	if first.Options == second.Options || first.Options.Path != "/first" || second.Options.Path != "/" {
+		t.Errorf("Expected each config to get its own cookie options; Got %#v and %#v", first.Options, second.Options)
+	}
+	if second.CleanupInterval != time.Minute {
+		t.Errorf("Expected a cleanup interval of 1m; Got %s", second.CleanupInterval)
+	}
+}
+
+func Test_WithTenant(t *testing.T) {
+	keyPairs := [][]byte{[]byte("my-secret-key")}
+	cfg, err := configFromOptions(dbUrl, keyPairs, WithTenant("acme"))
+	if err != nil || cfg.Tenant != "acme" {
+		t.Fatalf("Expected tenant acme; Got %q, %v", cfg.Tenant, err)
+	}
+	for _, tenant := range []string{"", "Acme", "acme corp", "acme\u200b"} {
+		if _, err = configFromOptions(dbUrl, keyPairs, WithTenant(tenant)); err == nil {
+			t.Errorf("Expected an error for tenant %q", tenant)
+		}
+	}
+}
+
+func Test_WithSearchScanLimit(t *testing.T) {
+	keyPairs := [][]byte{[]byte("my-secret-key")}
+	cfg, err := configFromOptions(dbUrl, keyPairs, WithSearchScanLimit(1000))
+	if err != nil {
+		t.Fatalf("Error applying options: %v", err)
+	}
+	if cfg.SearchScanLimit != 1000 {
+		t.Errorf("Expected a search scan limit of 1000; Got %d", cfg.SearchScanLimit)
+	}
+	if _, err = configFromOptions(dbUrl, keyPairs, WithSearchScanLimit(-1)); err == nil {
+		t.Errorf("Expected an error for a negative search scan limit")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build pgx
+
+package postgrestore
+
+// Registers the "pgx" driver for PGSTORE_TEST_DRIVER=pgx.
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -10,8 +10,11 @@
 package postgrestore
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
 	"encoding/gob"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/gorilla/securecookie"
@@ -19,245 +22,1220 @@ import (
 	_ "github.com/lib/pq"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
+// defaultMaxLength is the default PGStore.MaxLength, the same as securecookie's default.
+const defaultMaxLength = 4096
+
 type PGStore struct {
-	db         *sql.DB
-	stmtInsert *sql.Stmt
-	stmtDelete *sql.Stmt
-	stmtUpdate *sql.Stmt
-	stmtSelect *sql.Stmt
-	Codecs     []securecookie.Codec
-	Options    *sessions.Options
+	// mu guards db and the prepared statements, which are replaced when the pool is rebuilt.
+	mu             sync.RWMutex
+	config         Config
+	lastRebuild    time.Time
+	db             *sql.DB
+	ownsDB         bool
+	schema         string
+	table          string
+	stmtInsert     *sql.Stmt
+	stmtDelete     *sql.Stmt
+	stmtUpdate     *sql.Stmt
+	stmtSelect     *sql.Stmt
+	stmtRotateCSRF *sql.Stmt
+	statements     map[string]string
+	csrfSecrets    bool
+	kms            KMSClient
+	tags           bool
+	logger         *log.Logger
+	guard          *enumerationGuard
+	Codecs         []securecookie.Codec
+	// LegacyCodecs are tried after Codecs fail to decode a cookie or the stored session data,
+	// to migrate to a different cookie scheme without invalidating outstanding sessions.
+	// Anything they decode is encoded with Codecs, and CookieCodec, on the next Save.  Key
+	// rotation within one scheme does not need them: list the keys in Codecs instead.
+	LegacyCodecs []securecookie.Codec
+	Options      *sessions.Options
+	// CookieCodec encodes the session ID carried by the cookie.  Defaults to a
+	// SecureCookieCodec over Codecs.
+	CookieCodec CookieCodec
+	// MaxLength caps the length of the encoded session data Save writes, 4096 bytes by default.
+	// Zero means no limit.  See SetMaxLength.
+	MaxLength int
+	// Serializer encodes the stored session data.  When nil, the data is gob encoded and
+	// signed, and optionally encrypted, with Codecs, as by earlier versions.  Changing it makes
+	// existing sessions undecodable.
+	Serializer Serializer
+	// ExpiresHeader, when set, names a response header, e.g. "X-Session-Expires", that Save
+	// fills with the RFC 3339 expiry of the session so single-page apps can refresh it ahead of
+	// time.  Like the cookie, it is not written when DeferCookies is set.
+	ExpiresHeader string
+	// InjectTimestamps adds the "created_on", "modified_on" and "expires_on" timestamps to
+	// session.Values when a session is loaded, to be read with CreatedOn, ModifiedOn and
+	// ExpiresOn.  Turn it off to have session.Values hold only the application's own keys.
+	// Flashes are stored under their own keys and never see the timestamps either way.
+	// The keys are never written to the database: changing them has no effect, except that a
+	// time.Time stored under "expires_on" before a new session is first saved sets its expiry;
+	// SetExpiry is the explicit way to do so.
+	InjectTimestamps bool
+	// DeferCookies stops Save from writing the Set-Cookie header.  The cookie must then be
+	// fetched with PendingCookie, or written with WriteCookie, once the caller is ready.
+	DeferCookies bool
+	// cleanupMu guards the channels of the sweeper started by StartCleanup.
+	cleanupMu   sync.Mutex
+	cleanupQuit chan struct{}
+	cleanupDone chan struct{}
 }
 
 // NewPostgreSQLStore opens a connection to the given database URL and checks for the eistence of
 // a table named "http_sessions".  If none exists, one is created to store session data.
+// It is a shorthand for New; use a Config to reach the remaining settings.
 func NewPostgreSQLStore(dbUrl string, path string, maxAge int, keyPairs ...[]byte) (dbStore *PGStore, err error) {
-	db, err := sql.Open("postgres", dbUrl)
-	if err != nil {
-		return nil, err
-	}
-	// As of Postgres 9.1 could now use IF NOT EXISTS clause in createTable function, but since
-	// this works fine for earlier versions too we might as well leave it here.
-	stmt := "SELECT EXISTS(SELECT * FROM information_schema.tables WHERE table_name = 'http_sessions');"
-	row := db.QueryRow(stmt)
-	var exists bool
-	row.Scan(&exists)
-	if !exists {
-		err = createTable(db)
-		if err != nil {
-			return nil, err
-		}
-	}
-	insQ := "INSERT INTO http_sessions (data, created_on, modified_on, expires_on) VALUES ($1,$2,$3,$4) RETURNING id;"
-	stmtInsert, stmtErr := db.Prepare(insQ)
-	if stmtErr != nil {
-		return nil, stmtErr
-	}
-	delQ := "DELETE FROM http_sessions WHERE id = $1;"
-	stmtDelete, stmtErr := db.Prepare(delQ)
-	if stmtErr != nil {
-		return nil, stmtErr
-	}
-	updQ := "UPDATE http_sessions SET data=$1, modified_on=$2 where id=$3;"
-	stmtUpdate, stmtErr := db.Prepare(updQ)
-	if stmtErr != nil {
-		return nil, stmtErr
-	}
-	selQ := "SELECT data, created_on, modified_on, expires_on FROM http_sessions WHERE id = $1;"
-	stmtSelect, stmtErr := db.Prepare(selQ)
-	if stmtErr != nil {
-		return nil, stmtErr
-	}
-	return &PGStore{
-		db:         db,
-		stmtInsert: stmtInsert,
-		stmtDelete: stmtDelete,
-		stmtUpdate: stmtUpdate,
-		stmtSelect: stmtSelect,
-		Codecs:     securecookie.CodecsFromPairs(keyPairs...),
+	return New(Config{
+		DSN: dbUrl,
 		Options: &sessions.Options{
 			Path:   path,
 			MaxAge: maxAge,
 		},
-	}, nil
+		KeyPairs: keyPairs,
+	})
+}
+
+// NewPGStoreFromPool creates a store like NewPostgreSQLStore, but on the caller's connection pool
+// instead of opening its own, so one pool can be shared with e.g. an ORM.  The table check and
+// the prepared statements run against db, and Close leaves db open.
+func NewPGStoreFromPool(db *sql.DB, path string, maxAge int, keyPairs ...[]byte) (*PGStore, error) {
+	return New(Config{
+		DB: db,
+		Options: &sessions.Options{
+			Path:   path,
+			MaxAge: maxAge,
+		},
+		KeyPairs: keyPairs,
+	})
+}
+
+// ensureTable checks for the existence of the sessions table in schema, or on the search_path if
+// schema is empty, and creates it if needed.  Roles that may not read information_schema fall
+// back to probing the table directly.
+func ensureTable(db *sql.DB, schema, table string, idType IDType) error {
+	// The check spares roles without the CREATE privilege a failing CREATE TABLE; instances
+	// starting at the same time may still both get here, which createTable tolerates.
+	cond, args := inSchema("table_schema", schema, 2)
+	stmt := "SELECT EXISTS(SELECT * FROM information_schema.tables WHERE table_name = $1 AND " + cond + ");"
+	row := db.QueryRow(stmt, append([]interface{}{table}, args...)...)
+	var exists bool
+	if err := row.Scan(&exists); err != nil {
+		if pqCode(err) != "42501" { // insufficient_privilege
+			return err
+		}
+		if exists, err = probeTable(db, qualify(schema, table)); err != nil {
+			return err
+		}
+	}
+	if !exists {
+		return createTable(db, schema, table, idType)
+	}
+	return nil
+}
+
+// probeTable reports whether the sessions table exists by selecting from it.
+func probeTable(db *sql.DB, table string) (bool, error) {
+	var one int
+	err := db.QueryRow(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1;", table)).Scan(&one)
+	switch {
+	case err == nil || err == sql.ErrNoRows:
+		return true, nil
+	case pqCode(err) == "42P01": // undefined_table
+		return false, nil
+	}
+	return false, err
+}
+
+// prepare (re)creates the prepared statements used by the store.  Optional columns, such as
+// "csrf_secret", are only referenced once the corresponding feature has been enabled.  Either
+// all statements are replaced or, if any of them fails to prepare, none are.
+func (dbStore *PGStore) prepare() error {
+	queries := []struct {
+		name  string
+		stmt  **sql.Stmt
+		query string
+	}{
+		{"insert", &dbStore.stmtInsert, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id;", dbStore.table,
+			strings.Join(dbStore.insertColumns(), ", "), placeholders(len(dbStore.insertColumns())))},
+		{"delete", &dbStore.stmtDelete, dbStore.deleteQuery()},
+		{"update", &dbStore.stmtUpdate, fmt.Sprintf("UPDATE %s SET %s where id=$%d%s RETURNING expires_on;",
+			dbStore.table, dbStore.updateAssignments(), len(dbStore.updateColumns())+1,
+			dbStore.tenantCondition(len(dbStore.updateColumns())+3))},
+		{"select", &dbStore.stmtSelect, fmt.Sprintf("SELECT %s FROM %s WHERE id = $1%s;",
+			strings.Join(dbStore.selectColumns(), ", "), dbStore.table, dbStore.validityClause())},
+	}
+	if dbStore.csrfSecrets {
+		queries = append(queries, struct {
+			name  string
+			stmt  **sql.Stmt
+			query string
+		}{"rotate_csrf", &dbStore.stmtRotateCSRF, fmt.Sprintf("UPDATE %s SET csrf_secret=$1 WHERE id=$2%s;", dbStore.table, dbStore.tenantCondition(3))})
+	}
+	prepared := make([]*sql.Stmt, 0, len(queries))
+	for _, q := range queries {
+		stmt, err := dbStore.db.Prepare(q.query)
+		if err != nil {
+			for _, stmt := range prepared {
+				stmt.Close()
+			}
+			return err
+		}
+		prepared = append(prepared, stmt)
+	}
+	if err := dbStore.closeStatements(); err != nil {
+		dbStore.logger.Printf("Unable to release the replaced prepared statements: %s", err.Error())
+	}
+	dbStore.statements = make(map[string]string, len(queries))
+	for i, q := range queries {
+		*q.stmt = prepared[i]
+		dbStore.statements[q.name] = q.query
+	}
+	return nil
+}
+
+// Statements reports the SQL of the statements currently prepared by the store, keyed by
+// "insert", "update", "select", "delete" and, with CSRF secrets, "rotate_csrf".  It is meant for
+// debugging; each store prepares its own statements, so closing one store never affects another.
+func (dbStore *PGStore) Statements() map[string]string {
+	dbStore.mu.RLock()
+	defer dbStore.mu.RUnlock()
+	statements := make(map[string]string, len(dbStore.statements))
+	for name, query := range dbStore.statements {
+		statements[name] = query
+	}
+	return statements
 }
 
-func createTable(db *sql.DB) (err error) {
-	stmt := "CREATE TABLE http_sessions (" +
-		"id SERIAL PRIMARY KEY," +
+// insertColumns lists the columns written by the insert statement, in parameter order.
+func (dbStore *PGStore) insertColumns() []string {
+	cols := []string{"data", "created_on", "modified_on", "expires_on"}
+	if dbStore.csrfSecrets {
+		cols = append(cols, "csrf_secret")
+	}
+	if dbStore.kms != nil {
+		cols = append(cols, "data_key")
+	}
+	if dbStore.config.Fingerprint != nil {
+		cols = append(cols, "fingerprint")
+	}
+	if dbStore.config.LocaleColumns {
+		cols = append(cols, "locale", "timezone")
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		cols = append(cols, "last_accessed_at")
+	}
+	if dbStore.config.CreationContext != nil {
+		cols = append(cols, "creation_context")
+	}
+	if dbStore.config.MaxSessionsPerIP > 0 {
+		cols = append(cols, "ip_address")
+	}
+	if dbStore.config.Tenant != "" {
+		cols = append(cols, "tenant")
+	}
+	if dbStore.config.IDType == IDTypeUUID {
+		cols = append(cols, "id")
+	}
+	return cols
+}
+
+// updateColumns lists the columns written by the update statement, in parameter order.  The
+// session ID is bound to the parameter following the last column.
+func (dbStore *PGStore) updateColumns() []string {
+	cols := []string{"data", "modified_on"}
+	if dbStore.kms != nil {
+		cols = append(cols, "data_key")
+	}
+	if dbStore.config.LocaleColumns {
+		cols = append(cols, "locale", "timezone")
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		cols = append(cols, "last_accessed_at")
+	}
+	return cols
+}
+
+// updateAssignments returns the SET clause of the update statement.  With revisions enabled the
+// revision is incremented within the same statement, so concurrent updates never share one.
+// The new expiry follows the session ID and keeps the current one when NULL.
+func (dbStore *PGStore) updateAssignments() string {
+	cols := dbStore.updateColumns()
+	set := assignments(cols)
+	set += fmt.Sprintf(", expires_on=COALESCE($%d::timestamptz, expires_on)", len(cols)+2)
+	if dbStore.config.Revisions {
+		set += ", revision=revision+1"
+	}
+	return set
+}
+
+// selectColumns lists the columns read by the select statement, in scan order.
+func (dbStore *PGStore) selectColumns() []string {
+	cols := []string{"data", "created_on", "modified_on", "expires_on"}
+	if dbStore.csrfSecrets {
+		cols = append(cols, "csrf_secret")
+	}
+	if dbStore.kms != nil {
+		cols = append(cols, "data_key")
+	}
+	if dbStore.config.Fingerprint != nil {
+		cols = append(cols, "fingerprint")
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		cols = append(cols, "last_accessed_at")
+	}
+	if dbStore.config.GlobalGeneration {
+		cols = append(cols, fmt.Sprintf("global_generation < %s()", dbStore.companionName("generation")))
+	}
+	if dbStore.config.GraceDeleteWindow > 0 {
+		cols = append(cols, "delete_after IS NOT NULL")
+	}
+	return cols
+}
+
+// assignments returns "col1=$1, col2=$2, ..." for use in an UPDATE statement.
+func assignments(cols []string) string {
+	set := make([]string, len(cols))
+	for i, col := range cols {
+		set[i] = fmt.Sprintf("%s=$%d", col, i+1)
+	}
+	return strings.Join(set, ", ")
+}
+
+// placeholders returns a comma separated list of n positional parameters, i.e. "$1,$2,...,$n".
+func placeholders(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return strings.Join(params, ",")
+}
+
+// createTable creates the sessions table.  Losing the race against another instance creating it
+// at the same time is not an error: IF NOT EXISTS covers a table that is already committed, and
+// the error codes cover one that is still being created.
+func createTable(db *sql.DB, schema, table string, idType IDType) (err error) {
+	qualified := qualify(schema, table)
+	stmt := "CREATE TABLE IF NOT EXISTS " + qualified + " (" +
+		"id " + idType.columnType() + "," +
 		"data BYTEA," +
 		"created_on TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP," +
 		"modified_on TIMESTAMPTZ," +
 		"expires_on TIMESTAMPTZ);"
 	_, err = db.Exec(stmt)
+	if err == nil {
+		// cleanup deletes by expires_on; see EnsureIndexes for tables created before this index
+		_, err = db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_on_idx ON %s (expires_on);", table, qualified))
+	}
+	switch pqCode(err) {
+	case "42P07", // duplicate_table, or the index created concurrently
+		"23505": // unique_violation, on the table's type in pg_type
+		err = nil
+	}
 	if err != nil {
-		msg := fmt.Sprintf("Unable to create http_sessions table in the database: %s\n", err.Error())
+		msg := fmt.Sprintf("Unable to create %s table in the database: %s\n", qualified, err.Error())
 		return errors.New(msg)
 	} else {
 		return nil
 	}
 }
 
-// Closes the connection to the database.
+// Closes the connection to the database.  A pool passed in by the caller, e.g. to
+// NewPGStoreFromPool, is left open; only the store's prepared statements are released.
+// A sweeper started with StartCleanup is stopped first, and a schema created for
+// Config.EphemeralSchema is dropped.  Errors are logged; use CloseWithError to handle them.
 func (dbStore *PGStore) Close() {
-	dbStore.stmtSelect.Close()
-	dbStore.stmtUpdate.Close()
-	dbStore.stmtDelete.Close()
-	dbStore.stmtInsert.Close()
-	dbStore.db.Close()
+	if err := dbStore.CloseWithError(); err != nil {
+		dbStore.logger.Printf("Unable to close the session store cleanly: %s", err.Error())
+	}
+}
+
+// CloseWithError is Close, but returns the errors of releasing the prepared statements,
+// dropping the ephemeral schema and closing the pool, joined with errors.Join, instead of
+// logging them.  Every step is attempted even if an earlier one fails.
+func (dbStore *PGStore) CloseWithError() error {
+	dbStore.StopCleanup()
+	dbStore.mu.Lock()
+	defer dbStore.mu.Unlock()
+	errs := []error{dbStore.closeStatements()}
+	if dbStore.config.EphemeralSchema {
+		if err := dropEphemeralSchema(dbStore.db, dbStore.schema); err != nil {
+			errs = append(errs, fmt.Errorf("Unable to drop the ephemeral schema %s: %w", dbStore.schema, err))
+		}
+		dbStore.config.EphemeralSchema = false
+	}
+	if dbStore.ownsDB {
+		if err := dbStore.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Unable to close the database pool: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeStatements releases any prepared statements held by the store and returns the errors of
+// closing them.
+func (dbStore *PGStore) closeStatements() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{dbStore.stmtSelect, dbStore.stmtUpdate, dbStore.stmtDelete,
+		dbStore.stmtInsert, dbStore.stmtRotateCSRF} {
+		if stmt != nil {
+			if err := stmt.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("Unable to close a prepared statement: %w", err))
+			}
+		}
+	}
+	dbStore.stmtSelect, dbStore.stmtUpdate, dbStore.stmtDelete = nil, nil, nil
+	dbStore.stmtInsert, dbStore.stmtRotateCSRF = nil, nil
+	dbStore.statements = nil
+	return errors.Join(errs...)
 }
 
 // Get returns a session for the given name after it has been added to the registry.
+// The registry lives in the request context and caches sessions by name, so repeated calls
+// during the same request, e.g. from stacked middleware, load the session from the database
+// only once.  Requests derived with WithContext share the cache once Get has been called.
 func (dbStore *PGStore) Get(r *http.Request, name string) (*sessions.Session, error) {
 	return sessions.GetRegistry(r).Get(dbStore, name)
 }
 
-// New returns a new session for the given name without adding it to the registry.
+// GetContext is like Get, but loads the session with ctx, e.g. the request's context, so that
+// a slow or unreachable database cannot block the caller beyond its deadline.  A session
+// already in the registry is returned as is.
+func (dbStore *PGStore) GetContext(ctx context.Context, r *http.Request, name string) (*sessions.Session, error) {
+	session, _, err := dbStore.register(ctx, r, name)
+	return session, err
+}
+
+// register is Get with a context, also reporting the status of the session.  Sessions already
+// in the registry are reported as SessionLoaded or SessionNew.
+func (dbStore *PGStore) register(ctx context.Context, r *http.Request, name string) (*sessions.Session, SessionStatus, error) {
+	registry := sessions.GetRegistry(r)
+	status := statusCached
+	session, err := registry.Get(contextStore{PGStore: dbStore, ctx: ctx, status: &status}, name)
+	if session == nil {
+		return nil, SessionNew, err
+	}
+	// the registry hands out cached sessions, so this only points the session back at the
+	// store itself rather than at the wrapper
+	registry.Get(dbStore, name)
+	if status == statusCached {
+		status = SessionLoaded
+		if session.IsNew {
+			status = SessionNew
+		}
+	}
+	return session, status, err
+}
+
+// contextStore lets the registry create sessions with NewContext, recording their status.
+type contextStore struct {
+	*PGStore
+	ctx    context.Context
+	status *SessionStatus
+}
+
+// New implements sessions.Store.
+func (s contextStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session, status, err := s.PGStore.newSession(s.ctx, r, name)
+	*s.status = status
+	return session, err
+}
+
+// New returns a new session for the given name without adding it to the registry.  A session
+// cookie that cannot be decoded, e.g. because it was tampered with, is ignored and a new session
+// returned, as for an expired one; see Config.StrictCookies to have it reported.
 // Note: the "created_on" date is only set when 'Save' is called.  "created_on" is only
 // set once.  Changes to this field in the session struct are ignored.
 func (dbStore *PGStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	return dbStore.NewContext(context.Background(), r, name)
+}
+
+// NewContext is like New, but loads the session with ctx.
+func (dbStore *PGStore) NewContext(ctx context.Context, r *http.Request, name string) (*sessions.Session, error) {
+	session, _, err := dbStore.newSession(ctx, r, name)
+	return session, err
+}
+
+// newSession implements NewContext, also reporting why the session is new, if it is.
+func (dbStore *PGStore) newSession(ctx context.Context, r *http.Request, name string) (*sessions.Session, SessionStatus, error) {
 	session := sessions.NewSession(dbStore, name)
-	session.Options = &sessions.Options{
-		Path:   dbStore.Options.Path,
-		MaxAge: dbStore.Options.MaxAge,
-	}
+	// every field is copied, so e.g. HttpOnly and Domain set on the store reach the cookie
+	options := *dbStore.Options
+	session.Options = dbStore.cookieOptions(r, &options)
 	session.IsNew = true
 
 	var err error
-	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, dbStore.Codecs...)
-		if err == nil {
-			err = dbStore.load(session)
-			if err == nil {
-				session.IsNew = false
-			} else if err == sql.ErrNoRows || err.Error() == "Session expired" {
-				// found a matching cookie, but no valid session in the db OR
-				// the session has actually expired -
-				// treat either case as expired and just create a new session
-				err = nil
-			}
+	status := SessionNew
+	// browsers may send several cookies of the same name, e.g. after the cookie domain changed
+	// from example.com to .example.com, and the first of them can be stale; use the first one
+	// that loads, reporting the outcome of the first cookie if none does
+	for i, c := range sameNameCookies(r, name) {
+		if i > 0 {
+			session.ID = ""
+			session.Values = make(map[interface{}]interface{})
+		}
+		cookieStatus, cookieErr := dbStore.loadCookie(ctx, r, session, c.Value)
+		done := cookieStatus == SessionLoaded || (cookieErr != nil && cookieStatus != SessionDecodeFailedReset)
+		if i == 0 || done {
+			status, err = cookieStatus, cookieErr
+		}
+		if done {
+			break
 		}
 	}
-	return session, err
+	return session, status, err
+}
+
+// sameNameCookies returns the cookies of r named name, in the order the client sent them.
+func sameNameCookies(r *http.Request, name string) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies
+}
+
+// loadCookie loads the session whose ID is encoded in the cookie value into session.
+func (dbStore *PGStore) loadCookie(ctx context.Context, r *http.Request, session *sessions.Session, value string) (SessionStatus, error) {
+	var err error
+	session.ID, err = dbStore.decodeCookie(session.Name(), value)
+	if err != nil {
+		session.ID = ""
+		if dbStore.config.StrictCookies {
+			return SessionDecodeFailedReset, &CookieError{Name: session.Name(), Err: err}
+		}
+		return SessionDecodeFailedReset, nil
+	}
+	if dbStore.guard != nil && dbStore.guard.blocked(clientIP(r)) {
+		session.ID = ""
+		return SessionNew, ErrTooManyFailedLoads
+	}
+	err = dbStore.load(ctx, r, session, false)
+	if err == sql.ErrNoRows && dbStore.guard != nil {
+		dbStore.guard.fail(clientIP(r))
+	}
+	if err == nil {
+		session.IsNew = false
+		return SessionLoaded, nil
+	} else if err == errSessionOversized {
+		// the stored data can no longer be decoded due to its size
+		return SessionDecodeFailedReset, nil
+	} else if err == sql.ErrNoRows || err == errFingerprintMismatch ||
+		err == errSessionIdle || err == errSessionRevoked || err == errSessionDeleted ||
+		errors.Is(err, ErrSessionExpired) {
+		// found a matching cookie, but no valid session in the db OR
+		// the session has actually expired, idled out or been revoked OR it belongs to another device -
+		// treat any case as expired and just create a new session
+		return SessionExpiredReset, nil
+	}
+	return SessionNew, err
+}
+
+// storedRow holds the columns of a session row read by the select statement.
+type storedRow struct {
+	encodedData                      string
+	createdOn, modifiedOn, expiresOn time.Time
+	csrfSecret, fingerprint          sql.NullString
+	lastAccessedAt                   sql.NullTime
+	revoked, deleted                 bool
+	dataKey                          []byte
 }
 
-// load fetches a session by ID from the database and decodes its content into session.Values
-func (dbStore *PGStore) load(session *sessions.Session) error {
-	row := dbStore.stmtSelect.QueryRow(session.ID)
-	var encodedData string
-	var createdOn, modifiedOn, expiresOn time.Time
-	err := row.Scan(&encodedData, &createdOn, &modifiedOn, &expiresOn)
+// scanDest returns the scan destinations for the columns listed by selectColumns.
+func (dbStore *PGStore) scanDest(row *storedRow) []interface{} {
+	dest := []interface{}{&row.encodedData, &row.createdOn, zeroIfNull{&row.modifiedOn}, &row.expiresOn}
+	if dbStore.csrfSecrets {
+		dest = append(dest, &row.csrfSecret)
+	}
+	if dbStore.kms != nil {
+		dest = append(dest, &row.dataKey)
+	}
+	if dbStore.config.Fingerprint != nil {
+		dest = append(dest, &row.fingerprint)
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		dest = append(dest, &row.lastAccessedAt)
+	}
+	if dbStore.config.GlobalGeneration {
+		dest = append(dest, &row.revoked)
+	}
+	if dbStore.config.GraceDeleteWindow > 0 {
+		dest = append(dest, &row.deleted)
+	}
+	return dest
+}
+
+// load fetches a session by ID from the database and decodes its content into session.Values.
+// The request the session was presented with is checked against the stored device fingerprint.
+// A peek only reads: it neither checks the fingerprint nor writes anything back to the row.
+func (dbStore *PGStore) load(ctx context.Context, r *http.Request, session *sessions.Session, peek bool) error {
+	var row storedRow
+	dest := dbStore.scanDest(&row)
+	readCtx, cancel := dbStore.readContext(ctx)
+	defer cancel()
+	start := time.Now()
+	err := dbStore.withReconnect(func() error {
+		return dbStore.stmtSelect.QueryRowContext(readCtx, dbStore.selectArgs(session.ID)...).Scan(dest...)
+	})
+	if err == nil && row.encodedData == "" {
+		// an uncommitted reservation made by ReserveID
+		err = sql.ErrNoRows
+	} else if pqCode(err) == "22P02" { // invalid_text_representation
+		// not an ID of this table's type, e.g. a serial ID looked up in a UUID table
+		err = sql.ErrNoRows
+	}
+	err = classify(err)
+	dbStore.observe("load", dbStore.config.Hooks.OnLoad, session.ID, start, err)
 	if err != nil {
 		return err
 	}
+	return dbStore.restore(ctx, r, session, &row, peek)
+}
+
+// restore checks a row read by load and decodes it into session.
+func (dbStore *PGStore) restore(ctx context.Context, r *http.Request, session *sessions.Session, row *storedRow, peek bool) error {
+	var err error
+	if row.deleted {
+		return errSessionDeleted
+	}
 	// check session expiration date
-	if expiresOn.Sub(time.Now()) < 0 {
-		log.Printf("Session expired on %s, but it is %s now.", expiresOn, time.Now())
-		return errors.New("Session expired")
+	if dbStore.expired(row.expiresOn, time.Now()) {
+		dbStore.logger.Printf("Session expired on %s, but it is %s now.", row.expiresOn, time.Now())
+		return ErrSessionExpired
 	}
-	err = securecookie.DecodeMulti(session.Name(), encodedData, &session.Values, dbStore.Codecs...)
+	if row.revoked {
+		return errSessionRevoked
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		if err = dbStore.checkIdle(session.ID, row.lastAccessedAt); err != nil {
+			return err
+		}
+	}
+	if !peek {
+		if err = dbStore.checkFingerprint(r, session.ID, row.fingerprint); err != nil {
+			return err
+		}
+	}
+	// codec is the index of the codec that decoded the data, 0 being the primary one
+	codec, err := dbStore.decodeStored(ctx, session, row.encodedData, row.dataKey)
 	if err != nil {
+		if dbStore.config.ResetOversized && isDecodeTooLong(err) {
+			dbStore.logger.Printf("Session %s exceeds the codecs' MaxLength and has been reset", dbStore.redact(session.ID))
+			return errSessionOversized
+		}
 		return err
 	}
-	session.Values["created_on"] = createdOn
-	session.Values["modified_on"] = modifiedOn
-	session.Values["expires_on"] = expiresOn
+	// rows written by older versions may carry stale metadata in the encoded data
+	for _, key := range metadataKeys {
+		delete(session.Values, key)
+	}
+	if dbStore.InjectTimestamps {
+		session.Values["created_on"] = row.createdOn
+		if !row.modifiedOn.IsZero() {
+			// left NULL until the first update with Config.LeaveModifiedOnNull
+			session.Values["modified_on"] = row.modifiedOn
+		}
+		session.Values["expires_on"] = row.expiresOn
+	}
+	if dbStore.config.Enrich != nil {
+		if err = dbStore.enrich(ctx, session); err != nil {
+			return err
+		}
+	}
+	csrfSecret := row.csrfSecret
+	if dbStore.csrfSecrets && (csrfSecret.Valid || !peek) {
+		if !csrfSecret.Valid {
+			// the row predates EnableCSRFSecrets, so give it a secret now
+			if csrfSecret.String, err = dbStore.RotateCSRFSecret(ctx, session.ID); err != nil {
+				return err
+			}
+		}
+		session.Values["csrf_secret"] = csrfSecret.String
+	}
+	if dbStore.config.KeyRotation && codec > 0 && !peek {
+		// re-encode the data with the primary key right away, rather than waiting for a Save
+		if _, err = dbStore.update(ctx, session, nil); err != nil {
+			return err
+		}
+	}
+	if dbStore.config.IdleTimeout > 0 && !peek {
+		return dbStore.touch(ctx, session.ID)
+	}
 	return nil
 }
 
+// decodeStored decodes the data column of a row, and its wrapped data key if any, into
+// session.Values.  It returns the index of the codec that decoded the data, 0 being the primary
+// one, or 0 with a Serializer.
+func (dbStore *PGStore) decodeStored(ctx context.Context, session *sessions.Session, encodedData string, dataKey []byte) (int, error) {
+	return dbStore.decodeStoredWith(ctx, session, encodedData, dataKey, dbStore.Serializer)
+}
+
+// decodeStoredWith is decodeStored with the given serializer, nil standing for the codecs.
+func (dbStore *PGStore) decodeStoredWith(ctx context.Context, session *sessions.Session, encodedData string, dataKey []byte, serializer Serializer) (int, error) {
+	var err error
+	if dataKey != nil {
+		// envelope encrypted; rows written before a KMS was configured have no data key
+		if encodedData, err = dbStore.open(ctx, []byte(encodedData), dataKey); err != nil {
+			return 0, err
+		}
+	}
+	if encodedData, err = dbStore.decompress(encodedData); err != nil {
+		return 0, err
+	}
+	codec := 0
+	if serializer != nil {
+		err = serializer.Deserialize([]byte(encodedData), session)
+	} else {
+		codec, err = decodeData(session.Name(), encodedData, &session.Values, dbStore.dataCodecs())
+	}
+	if err != nil {
+		return 0, err
+	}
+	if fe := dbStore.config.FieldEncryptor; fe != nil {
+		if err = fe.decrypt(session.Values); err != nil {
+			return 0, err
+		}
+	}
+	return codec, nil
+}
+
+// PeekByID loads the session with the given name and ID for inspection, without an HTTP request.
+// Unlike Get and New, which represent activity of the user holding the session, a peek is a
+// read-only system check (e.g. validating a websocket ping): it never writes to the session row,
+// so it will not extend or otherwise refresh the session.  Expired sessions are reported with
+// ErrSessionExpired; missing ones with sql.ErrNoRows.
+func (dbStore *PGStore) PeekByID(ctx context.Context, name string, id string) (*sessions.Session, error) {
+	session := sessions.NewSession(dbStore, name)
+	session.ID = id
+	opts := *dbStore.Options
+	session.Options = &opts
+	if err := dbStore.load(ctx, nil, session, true); err != nil {
+		return nil, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// ValuesByID returns the decoded values of the session with the given name and ID, for
+// background jobs that need a user's session data without an HTTP request.  Like PeekByID it
+// never writes to the session row and reports expired sessions with ErrSessionExpired and
+// missing ones with sql.ErrNoRows.  The returned map holds only the stored values: the timestamp
+// and CSRF metadata keys are left out regardless of InjectTimestamps.
+func (dbStore *PGStore) ValuesByID(ctx context.Context, name string, id string) (map[interface{}]interface{}, error) {
+	session, err := dbStore.PeekByID(ctx, name, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range metadataKeys {
+		delete(session.Values, key)
+	}
+	return session.Values, nil
+}
+
 // Save either inserts a new row in the database if none exists for the given session, or updates
-// the existing session if it already exists.  It also adds the session ID as a client-side cookie.
+// the existing session if it already exists.  It also adds the session ID as a client-side cookie,
+// so it must be called before the response body is written; net/http silently drops headers set
+// afterwards.  See Config.DetectWrittenHeaders to turn that mistake into an error.
+// A session whose Options.MaxAge is negative is deleted instead, as with Delete; the cookie
+// expiring it is written, or deferred, like the cookie of any other Save.
 func (dbStore *PGStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return dbStore.SaveContext(context.Background(), r, w, session)
+}
+
+// SaveContext is like Save, but writes to the database with ctx.
+func (dbStore *PGStore) SaveContext(ctx context.Context, r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if r != nil {
+		session.Options = dbStore.cookieOptions(r, session.Options)
+	}
+	if session.Options.MaxAge < 0 {
+		// a negative MaxAge ends the session, so the row goes along with the cookie
+		if !session.IsNew {
+			if err := dbStore.deleteSession(ctx, session); err != nil {
+				return err
+			}
+		}
+		if dbStore.DeferCookies {
+			return nil
+		}
+		// EncodeCookie returns the expiring cookie
+		return dbStore.WriteCookie(w, session)
+	}
 	var err error
+	var expiresOn time.Time
 	if session.IsNew {
-		if err = dbStore.insert(session); err != nil {
+		if expiresOn, err = dbStore.insert(ctx, r, session); err != nil {
 			return err
 		}
 	} else {
-		if err = dbStore.update(session); err != nil {
+		if expiresOn, err = dbStore.update(ctx, session, dbStore.newExpiry(session)); err != nil {
 			return err
 		}
 	}
+	delete(session.Values, expiryKey{})
+	if _, ok := session.Values["expires_on"]; ok && !expiresOn.IsZero() {
+		session.Values["expires_on"] = expiresOn
+	}
+	if dbStore.DeferCookies {
+		return nil
+	}
+	if dbStore.ExpiresHeader != "" && !expiresOn.IsZero() {
+		w.Header().Set(dbStore.ExpiresHeader, expiresOn.UTC().Format(time.RFC3339))
+	}
+	return dbStore.WriteCookie(w, session)
+}
+
+// EncodeCookie returns the cookie Save would set for session, the encoded session ID with the
+// session's options, without writing it, so it can be attached to a response the caller builds
+// itself.  A session whose Options.MaxAge is negative gets the cookie expiring it, as Save
+// would send.  Save derives the options from the request first, see Config.CookieOptionsFunc;
+// sessions returned by Get and New already carry the derived options.
+func (dbStore *PGStore) EncodeCookie(session *sessions.Session) (*http.Cookie, error) {
+	if session.Options.MaxAge < 0 {
+		return expiredCookie(session), nil
+	}
 	// Keep the session ID key in a cookie so it can be looked up in DB later.
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, dbStore.Codecs...)
+	encoded, err := dbStore.cookieCodec().Encode(session.Name(), session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return sessions.NewCookie(session.Name(), encoded, session.Options), nil
+}
+
+// PendingCookie returns the cookie that carries the ID of a saved session, without writing it.
+// It is intended for stores with DeferCookies set, where a framework controls when headers are
+// sent, and is the same as EncodeCookie.
+func (dbStore *PGStore) PendingCookie(session *sessions.Session) (*http.Cookie, error) {
+	return dbStore.EncodeCookie(session)
+}
+
+// WriteCookie adds the cookie returned by EncodeCookie to the response headers.  Together with
+// DeferCookies it can be used to commit the cookie before the response body is written.
+func (dbStore *PGStore) WriteCookie(w http.ResponseWriter, session *sessions.Session) error {
+	if err := dbStore.checkHeaders(w); err != nil {
+		return err
+	}
+	cookie, err := dbStore.EncodeCookie(session)
 	if err != nil {
 		return err
 	}
-	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	http.SetCookie(w, cookie)
 	return nil
 }
 
 // insert creates a new row in the database for the given session.  This is the only
 // time that the "created_on" field is set.
-func (dbStore *PGStore) insert(session *sessions.Session) error {
+func (dbStore *PGStore) insert(ctx context.Context, r *http.Request, session *sessions.Session) (time.Time, error) {
 	// createdOn is only set once, when the row is saved to the database.
 	// this avoids any ambiguity due to caller action.
 	var createdOn time.Time
 	createdOn = time.Now()
-	var modifiedOn time.Time
-	modifiedOn = createdOn
-	var expiresOn time.Time
-	exOn := session.Values["expires_on"]
-	if exOn == nil {
-		expiresOn = time.Now().Add(time.Second * time.Duration(session.Options.MaxAge))
-	} else {
-		expiresOn = exOn.(time.Time)
+	modifiedOn := dbStore.insertModifiedOn(createdOn)
+	expiresOn, err := requestedExpiry(session)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// refused sessions should not cost an encoding or a KMS call
+	ip := ipAddress(r)
+	if dbStore.config.MaxSessionsPerIP > 0 && ip.Valid {
+		if err = dbStore.checkSessionCap(ctx, ip.String); err != nil {
+			return time.Time{}, err
+		}
 	}
 	// clear any timestamp fields from the session data
 	delete(session.Values, "created_on")
 	delete(session.Values, "expires_on")
 	delete(session.Values, "modified_on")
+	delete(session.Values, "csrf_secret")
 	// string encode the session data and insert it into the database
-	encoded, encErr := securecookie.EncodeMulti(session.Name(), session.Values, dbStore.Codecs...)
+	encoded, encErr := dbStore.encodeValues(session)
 	if encErr != nil {
-		return encErr
+		return time.Time{}, encErr
+	}
+	// passed as bytes, since serialized data may hold backslashes, which bytea's text format
+	// treats as escapes
+	args := []interface{}{[]byte(encoded), createdOn, modifiedOn, expiresOn}
+	var csrfSecret string
+	if dbStore.csrfSecrets {
+		if csrfSecret, err = newCSRFSecret(); err != nil {
+			return time.Time{}, err
+		}
+		args = append(args, csrfSecret)
+	}
+	if dbStore.kms != nil {
+		data, wrappedKey, err := dbStore.sealFor(ctx, session, encoded)
+		if err != nil {
+			return time.Time{}, err
+		}
+		args[0] = data
+		args = append(args, wrappedKey)
+	}
+	if dbStore.config.Fingerprint != nil {
+		// sessions created outside of a request are bound to a device by AdoptSession
+		fingerprint := sql.NullString{}
+		if r != nil {
+			fingerprint = sql.NullString{String: dbStore.fingerprint(r), Valid: true}
+		}
+		args = append(args, fingerprint)
+	}
+	if dbStore.config.LocaleColumns {
+		args = append(args, localeArgs(session)...)
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		args = append(args, createdOn)
 	}
-	row := dbStore.stmtInsert.QueryRow(encoded, createdOn, modifiedOn, expiresOn)
-	var id int64
-	err := row.Scan(&id)
+	if dbStore.config.CreationContext != nil {
+		args = append(args, dbStore.creationContext(r))
+	}
+	if dbStore.config.MaxSessionsPerIP > 0 {
+		args = append(args, ip)
+	}
+	if _, args, err = dbStore.newRow(nil, args); err != nil {
+		return time.Time{}, err
+	}
+	writeCtx, cancel := dbStore.writeContext(ctx)
+	defer cancel()
+	var id string
+	start := time.Now()
+	err = dbStore.withReconnectWrite(func() error {
+		// the row is only committed once its ID has been read, so a failed scan cannot leave
+		// behind a session no cookie points to
+		tx, err := dbStore.db.BeginTx(writeCtx, nil)
+		if err != nil {
+			return err
+		}
+		if err = tx.StmtContext(writeCtx, dbStore.stmtInsert).QueryRowContext(writeCtx, args...).Scan(&id); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
 	if err != nil {
-		return err
+		err = classify(err)
+		dbStore.observe("insert", dbStore.config.Hooks.OnInsert, "", start, err)
+		return time.Time{}, err
 	} else {
-		session.ID = fmt.Sprintf("%d", id)
+		session.ID = id
+		dbStore.observe("insert", dbStore.config.Hooks.OnInsert, session.ID, start, nil)
 		session.IsNew = false
-		return nil
+		if dbStore.csrfSecrets {
+			session.Values["csrf_secret"] = csrfSecret
+		}
+		return expiresOn, nil
+	}
+}
+
+// metadataKeys are the session.Values keys the store fills in from dedicated columns.  They are
+// never part of the encoded session data, and neither are Config.EnrichKeys.
+var metadataKeys = []string{"created_on", "modified_on", "expires_on", "csrf_secret"}
+
+// encodeValues encodes session.Values, minus the metadata keys, with the store's Serializer or
+// codecs.  session.Values itself is left untouched.  Data longer than MaxLength is handed to
+// Config.TruncateFunc, if set, and encoded once more.
+func (dbStore *PGStore) encodeValues(session *sessions.Session) (string, error) {
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		values[key] = value
+	}
+	for _, key := range metadataKeys {
+		delete(values, key)
+	}
+	for _, key := range dbStore.config.EnrichKeys {
+		delete(values, key)
+	}
+	delete(values, expiryKey{})
+	if dbStore.config.MaxFlashes > 0 {
+		dbStore.trimFlashes(session.ID, values)
+	}
+	encoded, err := dbStore.encodeMap(session, values)
+	if truncate := dbStore.config.TruncateFunc; truncate != nil {
+		if overBy := dbStore.overBy(encoded, err); overBy > 0 {
+			dbStore.logger.Printf("Session %s is %d bytes too long, truncating it", dbStore.redact(session.ID), overBy)
+			truncate(values, overBy)
+			// only one retry, a TruncateFunc that sheds too little must not loop forever
+			encoded, err = dbStore.encodeMap(session, values)
+			if _, tooLong := encodedTooLong(err); tooLong {
+				err = ErrValueTooBig
+			}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return dbStore.checkLength(encoded)
+}
+
+// encodeMap encodes values, the stored values of session, without checking their length.
+func (dbStore *PGStore) encodeMap(session *sessions.Session, values map[interface{}]interface{}) (string, error) {
+	return dbStore.encodeMapWith(session, values, dbStore.Serializer)
+}
+
+// encodeMapWith is encodeMap with the given serializer, nil standing for the codecs.
+func (dbStore *PGStore) encodeMapWith(session *sessions.Session, values map[interface{}]interface{}, serializer Serializer) (string, error) {
+	if fe := dbStore.config.FieldEncryptor; fe != nil {
+		var err error
+		if values, err = fe.encrypt(values); err != nil {
+			return "", err
+		}
+	}
+	if serializer != nil {
+		serialized := sessions.NewSession(dbStore, session.Name())
+		serialized.ID, serialized.Values, serialized.Options = session.ID, values, session.Options
+		data, err := serializer.Serialize(serialized)
+		return string(data), err
+	}
+	return securecookie.EncodeMulti(session.Name(), values, dbStore.Codecs...)
+}
+
+// overBy returns by how many bytes the result of encodeMap exceeds MaxLength, or the codecs'
+// limit if they rejected it, and 0 if it fits or failed for another reason.
+func (dbStore *PGStore) overBy(encoded string, err error) int {
+	limit := dbStore.MaxLength
+	if err == nil {
+		if limit > 0 && len(encoded) > limit {
+			return len(encoded) - limit
+		}
+		return 0
+	}
+	n, tooLong := encodedTooLong(err)
+	if !tooLong {
+		return 0
+	}
+	if limit == 0 || limit >= n {
+		// MaxLength was changed without SetMaxLength, so the codecs kept securecookie's default
+		limit = defaultMaxLength
+	}
+	if n <= limit {
+		// the codecs have a limit of their own; shedding anything may help
+		return 1
+	}
+	return n - limit
+}
+
+// checkLength rejects encoded session data longer than MaxLength, and compresses the rest.
+func (dbStore *PGStore) checkLength(encoded string) (string, error) {
+	if dbStore.MaxLength > 0 && len(encoded) > dbStore.MaxLength {
+		return "", ErrValueTooBig
+	}
+	return dbStore.compress(encoded)
+}
+
+// SetMaxLength sets MaxLength and the MaxLength of the securecookie codecs, which would
+// otherwise keep rejecting data longer than 4096 bytes.  l must not be negative; 0 removes the
+// limit.  Use with caution, since a bug that stuffs a session can then produce enormous rows.
+func (dbStore *PGStore) SetMaxLength(l int) {
+	if l < 0 {
+		return
+	}
+	dbStore.MaxLength = l
+	for _, c := range dbStore.Codecs {
+		if codec, ok := c.(*securecookie.SecureCookie); ok {
+			codec.MaxLength(l)
+		}
 	}
 }
 
 // update writes encoded session.Values, and an updated "modified_on" timestamp,
-// to the database record.  The "created_on" and "expires_on" fields cannot be
-// modified using this method.
-func (dbStore *PGStore) update(session *sessions.Session) error {
-	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values,
-		dbStore.Codecs...)
+// to the database record.  The "created_on" field cannot be modified using this method,
+// and "expires_on" only changes when expiresOn is not nil.
+// It returns the expiry of the session, or the zero time if the row no longer exists.
+func (dbStore *PGStore) update(ctx context.Context, session *sessions.Session, expiresOn interface{}) (time.Time, error) {
+	encoded, err := dbStore.encodeValues(session)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	_, err = dbStore.stmtUpdate.Exec(encoded, time.Now(), session.ID)
-	return err
+	modifiedOn := time.Now()
+	args := []interface{}{[]byte(encoded), modifiedOn}
+	if dbStore.kms != nil {
+		data, wrappedKey, err := dbStore.sealFor(ctx, session, encoded)
+		if err != nil {
+			return time.Time{}, err
+		}
+		args[0] = data
+		args = append(args, wrappedKey)
+	}
+	if dbStore.config.LocaleColumns {
+		args = append(args, localeArgs(session)...)
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		args = append(args, modifiedOn)
+	}
+	args = append(args, session.ID, expiresOn)
+	args = append(args, dbStore.tenantArgs()...)
+	writeCtx, cancel := dbStore.writeContext(ctx)
+	defer cancel()
+	var newExpiresOn time.Time
+	start := time.Now()
+	err = dbStore.withReconnectWrite(func() error {
+		return dbStore.stmtUpdate.QueryRowContext(writeCtx, args...).Scan(&newExpiresOn)
+	})
+	if err == sql.ErrNoRows {
+		// updating a row that has since been removed is not an error
+		err = nil
+	}
+	err = classify(err)
+	dbStore.observe("update", dbStore.config.Hooks.OnUpdate, session.ID, start, err)
+	return newExpiresOn, err
 }
 
 // Delete removes the given session from the databae and clears the session id
-// from the client cookie.
+// from the client cookie.  With Config.GraceDeleteWindow the row is only marked as deleted.
 func (dbStore *PGStore) Delete(w http.ResponseWriter, session *sessions.Session) error {
-	// Set cookie to expire.
-	options := *session.Options
-	options.MaxAge = -1
-	http.SetCookie(w, sessions.NewCookie(session.Name(), "", &options))
+	return dbStore.DeleteContext(context.Background(), w, session)
+}
+
+// DeleteContext is like Delete, but removes the row with ctx.
+func (dbStore *PGStore) DeleteContext(ctx context.Context, w http.ResponseWriter, session *sessions.Session) error {
+	dbStore.expireCookie(w, session)
+	return dbStore.deleteSession(ctx, session)
+}
+
+// deleteSession clears the values of session and deletes its row.
+func (dbStore *PGStore) deleteSession(ctx context.Context, session *sessions.Session) error {
 	// Clear session values.
 	for k := range session.Values {
 		delete(session.Values, k)
 	}
-	_, err := dbStore.stmtDelete.Exec(session.ID)
-	if err != nil {
+	return dbStore.deleteRow(ctx, session.ID)
+}
+
+// DeleteByID removes the session with the given ID, e.g. to log a user out from an admin tool.
+// No cookie is touched; the client's next request simply starts a new session.  Deleting a
+// missing session is not an error.  With Config.GraceDeleteWindow the row is only marked as
+// deleted, as with Delete.
+func (dbStore *PGStore) DeleteByID(ctx context.Context, id string) error {
+	return dbStore.deleteRow(ctx, id)
+}
+
+// deleteRow runs the delete statement for the session id.
+func (dbStore *PGStore) deleteRow(ctx context.Context, id string) error {
+	writeCtx, cancel := dbStore.writeContext(ctx)
+	defer cancel()
+	start := time.Now()
+	err := dbStore.withReconnect(func() error {
+		_, err := dbStore.stmtDelete.ExecContext(writeCtx, append([]interface{}{id}, dbStore.tenantArgs()...)...)
+		return err
+	})
+	err = classify(err)
+	dbStore.observe("delete", dbStore.config.Hooks.OnDelete, id, start, err)
+	return err
+}
+
+// cookieOptions applies Config.CookieOptionsFunc, if any, to a copy of base.
+func (dbStore *PGStore) cookieOptions(r *http.Request, base *sessions.Options) *sessions.Options {
+	if dbStore.config.CookieOptionsFunc == nil {
+		return base
+	}
+	options := *base
+	if derived := dbStore.config.CookieOptionsFunc(r, &options); derived != nil {
+		return derived
+	}
+	return &options
+}
+
+// expireCookie sets a cookie that makes the browser drop the session cookie.  Browsers only
+// honour it if it matches the original cookie, so it carries all of the session's options,
+// i.e. the same Path, Domain, Secure, HttpOnly and SameSite attributes.
+func (dbStore *PGStore) expireCookie(w http.ResponseWriter, session *sessions.Session) {
+	http.SetCookie(w, expiredCookie(session))
+}
+
+// expiredCookie returns the cookie set by expireCookie.
+func expiredCookie(session *sessions.Session) *http.Cookie {
+	options := *session.Options
+	options.MaxAge = -1
+	return sessions.NewCookie(session.Name(), "", &options)
+}
+
+// CookieScope is a Path and Domain combination a session cookie may have been issued for.
+type CookieScope struct {
+	Path   string
+	Domain string
+}
+
+// DeleteAllCookies deletes the session like Delete and additionally expires the session cookie
+// in each of scopes, e.g. the paths and domains used by earlier releases.  Browsers keep cookies
+// of different scopes side by side, so after the cookie scope changed a plain Delete would leave
+// the old cookies behind and logout would not fully clear the session.
+func (dbStore *PGStore) DeleteAllCookies(w http.ResponseWriter, session *sessions.Session, scopes []CookieScope) error {
+	for _, scope := range scopes {
+		options := *session.Options
+		options.Path, options.Domain, options.MaxAge = scope.Path, scope.Domain, -1
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", &options))
+	}
+	return dbStore.Delete(w, session)
+}
+
+// EnableCSRFSecrets adds a "csrf_secret" column to the sessions table, if it does not already
+// exist, and has the store generate a random secret for every session it inserts.  The secret is
+// kept server-side and exposed to handlers as session.Values["csrf_secret"] once the session has
+// been loaded or saved, so per-request synchronizer tokens can be derived from it.  It is never
+// written into the encoded session data.
+// The same can be requested at construction time with Config.CSRFSecrets.
+func (dbStore *PGStore) EnableCSRFSecrets() error {
+	dbStore.mu.Lock()
+	defer dbStore.mu.Unlock()
+	if err := dbStore.addCSRFColumn(); err != nil {
 		return err
 	}
+	dbStore.csrfSecrets = true
+	return dbStore.prepare()
+}
+
+// addCSRFColumn adds the "csrf_secret" column to the sessions table if it is missing.
+func (dbStore *PGStore) addCSRFColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS csrf_secret TEXT;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add csrf_secret column to the %s table: %s", dbStore.table, err.Error())
+	}
 	return nil
 }
 
+// RotateCSRFSecret replaces the CSRF secret of the session with the given ID and returns the new
+// secret.  Call it whenever the privileges of a session change, e.g. right after login.  Sessions
+// that are already loaded keep their old secret in session.Values until they are loaded again.
+func (dbStore *PGStore) RotateCSRFSecret(ctx context.Context, id string) (string, error) {
+	if !dbStore.csrfSecrets {
+		return "", errors.New("CSRF secrets are not enabled for this store")
+	}
+	secret, err := newCSRFSecret()
+	if err != nil {
+		return "", err
+	}
+	var n int64
+	err = dbStore.withReconnect(func() error {
+		res, err := dbStore.stmtRotateCSRF.ExecContext(ctx, append([]interface{}{secret, id}, dbStore.tenantArgs()...)...)
+		if err == nil {
+			n, err = res.RowsAffected()
+		}
+		return err
+	})
+	if err != nil {
+		return "", classify(err)
+	}
+	if n == 0 {
+		return "", sql.ErrNoRows
+	}
+	return secret, nil
+}
+
+// newCSRFSecret returns 32 bytes of random data, hex encoded.
+func newCSRFSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func init() {
 	gob.Register(time.Time{})
 }
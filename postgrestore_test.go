@@ -1,16 +1,45 @@
 package postgrestore
 
 import (
-	// "github.com/gorilla/securecookie"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/gob"
+	"errors"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
-// URL for travis db instance
-const dbUrl = "postgres://postgres@localhost/travis_postgrestore_test"
+// dbUrl and testDriver select the test database and the database/sql driver every test opens it
+// with: the travis db instance through lib/pq, unless PGSTORE_TEST_DSN or PGSTORE_TEST_DRIVER
+// is set.  Drivers other than lib/pq must be registered by the test binary, e.g. with
+// "go test -tags pgx" for pgx.
+var (
+	dbUrl      = testEnv("PGSTORE_TEST_DSN", "postgres://postgres@localhost/travis_postgrestore_test")
+	testDriver = testEnv("PGSTORE_TEST_DRIVER", defaultDriverName)
+)
+
+func testEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func TestMain(m *testing.M) {
+	// stores opened without a DriverName use the driver under test
+	defaultDriverName = testDriver
+	os.Exit(m.Run())
+}
 
 type FlashMessage struct {
 	Type    int
@@ -147,7 +176,7 @@ func Test_PostgreSQLStore(t *testing.T) {
 	cookies, ok = hdr["Set-Cookie"]
 	t.Logf("%#v", cookies)
 	if !ok || len(cookies) != 1 {
-		t.Fatalf("No cookies. Header:", hdr)
+		t.Fatalf("No cookies. Header: %v", hdr)
 	}
 
 	// Round 4 ----------------------------------------------------------------
@@ -201,10 +230,988 @@ func Test_PostgreSQLStore(t *testing.T) {
 	hdr = rsp.Header()
 	cookies, ok = hdr["Set-Cookie"]
 	if !ok || len(cookies) != 1 {
-		t.Fatalf("No cookies. Header:", hdr)
+		t.Fatalf("No cookies. Header: %v", hdr)
+	}
+}
+
+func Test_CSRFSecrets(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60*24*30, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	if err = store.EnableCSRFSecrets(); err != nil {
+		t.Fatalf("Error enabling CSRF secrets: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	session, err := store.Get(req, "csrf-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = sessions.Save(req, rsp); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	secret, ok := session.Values["csrf_secret"].(string)
+	if !ok || len(secret) != 64 {
+		t.Fatalf("Expected a CSRF secret after save; Got %#v", session.Values["csrf_secret"])
+	}
+	cookies := rsp.Header()["Set-Cookie"]
+	if len(cookies) != 1 {
+		t.Fatalf("No cookies. Header: %v", rsp.Header())
+	}
+
+	// the secret survives a round trip
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", cookies[0])
+	if session, err = store.Get(req, "csrf-session"); err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session.Values["csrf_secret"] != secret {
+		t.Errorf("Expected CSRF secret %s; Got %v", secret, session.Values["csrf_secret"])
+	}
+
+	// rotating replaces the stored secret
+	rotated, err := store.RotateCSRFSecret(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("Error rotating CSRF secret: %v", err)
+	}
+	if rotated == secret {
+		t.Errorf("Expected a new CSRF secret; Got the old one")
+	}
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", cookies[0])
+	if session, err = store.Get(req, "csrf-session"); err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session.Values["csrf_secret"] != rotated {
+		t.Errorf("Expected CSRF secret %s; Got %v", rotated, session.Values["csrf_secret"])
+	}
+	if session.Values["foo"] != "bar" {
+		t.Errorf("Expected foo=bar; Got %v", session.Values["foo"])
+	}
+	if err = store.Delete(httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+}
+
+func Test_DeferCookies(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60*24*30, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	store.DeferCookies = true
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	session, err := store.Get(req, "deferred-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = sessions.Save(req, rsp); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if cookies, ok := rsp.Header()["Set-Cookie"]; ok {
+		t.Fatalf("Expected no cookies before WriteCookie; Got %v", cookies)
+	}
+	cookie, err := store.PendingCookie(session)
+	if err != nil {
+		t.Fatalf("Error fetching pending cookie: %v", err)
+	}
+	if cookie.Name != "deferred-session" || cookie.Value == "" {
+		t.Errorf("Unexpected pending cookie %#v", cookie)
+	}
+	if err = store.WriteCookie(rsp, session); err != nil {
+		t.Fatalf("Error writing cookie: %v", err)
+	}
+	if cookies := rsp.Header()["Set-Cookie"]; len(cookies) != 1 {
+		t.Fatalf("No cookies. Header: %v", rsp.Header())
+	}
+
+	// ending the session defers the expiring cookie as well
+	session.Options.MaxAge = -1
+	rsp = httptest.NewRecorder()
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if cookies, ok := rsp.Header()["Set-Cookie"]; ok {
+		t.Errorf("Expected no cookies from Save with a negative MaxAge; Got %v", cookies)
+	}
+	if _, err = store.PeekByID(context.Background(), "deferred-session", session.ID); err == nil {
+		t.Errorf("Expected Save with a negative MaxAge to delete the session")
+	}
+}
+
+func Test_GetLoadsOncePerRequest(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60*24*30, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	session, err := store.Get(req, "cached-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = sessions.Save(req, rsp); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", rsp.Header().Get("Set-Cookie"))
+	first, err := store.Get(req, "cached-session")
+	if err != nil || first.IsNew {
+		t.Fatalf("Expected to load the saved session; Got %v", err)
+	}
+	// Remove the row behind the registry's back: a second query would now start a new session.
+	if _, err = store.stmtDelete.Exec(first.ID); err != nil {
+		t.Fatalf("Error deleting session row: %v", err)
+	}
+	second, err := store.Get(req.WithContext(req.Context()), "cached-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if second != first || second.IsNew || second.Values["foo"] != "bar" {
+		t.Errorf("Expected the second Get to be served from the request registry")
+	}
+}
+
+func Test_ResetOversized(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, ResetOversized: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	session, err := store.New(req, "oversized-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["blob"] = strings.Repeat("x", 2000)
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	// lower MaxLength below the stored data, but above the length of the cookie
+	store.Codecs[0].(*securecookie.SecureCookie).MaxLength(1000)
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", rsp.Header().Get("Set-Cookie"))
+	if session, err = store.New(req, "oversized-session"); err != nil {
+		t.Fatalf("Expected the oversized session to be reset; Got %v", err)
+	}
+	if !session.IsNew || len(session.Values) != 0 {
+		t.Errorf("Expected a new, empty session; Got %#v", session.Values)
+	}
+}
+
+func Test_InjectTimestamps(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, OmitTimestamps: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	rsp := httptest.NewRecorder()
+	session, err := store.New(req, "timestamp-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	session.AddFlash("hello")
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", rsp.Header().Get("Set-Cookie"))
+	if session, err = store.New(req, "timestamp-session"); err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if len(session.Values) != 2 || session.Values["foo"] != "bar" {
+		t.Errorf("Expected only the user keys; Got %#v", session.Values)
+	}
+	if flashes := session.Flashes(); len(flashes) != 1 || flashes[0] != "hello" {
+		t.Errorf("Expected the single flash; Got %v", flashes)
+	}
+
+	// with injection enabled the timestamps appear, but are never encoded with the data
+	store.InjectTimestamps = true
+	if session, err = store.New(req, "timestamp-session"); err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if _, ok := session.Values["created_on"].(time.Time); !ok {
+		t.Errorf("Expected created_on to be injected; Got %#v", session.Values)
+	}
+}
+
+func Test_ExpiresHeader(t *testing.T) {
+	store, err := NewPostgreSQLStoreWithOptions(dbUrl, [][]byte{[]byte("my-secret-key")},
+		WithMaxAge(3600), WithExpiresHeader("X-Session-Expires"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "expires-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+	// once for the insert, once for the update
+	for i := 0; i < 2; i++ {
+		rsp := httptest.NewRecorder()
+		if err = store.Save(req, rsp, session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		expires, err := time.Parse(time.RFC3339, rsp.Header().Get("X-Session-Expires"))
+		if err != nil {
+			t.Fatalf("Expected an RFC 3339 expiry header; Got %v", err)
+		}
+		if d := time.Until(expires); d < 59*time.Minute || d > time.Hour {
+			t.Errorf("Expected the session to expire in an hour; Got %v", d)
+		}
+	}
+}
+
+func Test_PeekByID(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "peek-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	peeked, err := store.PeekByID(context.Background(), "peek-session", session.ID)
+	if err != nil {
+		t.Fatalf("Error peeking at session: %v", err)
+	}
+	if peeked.Values["foo"] != "bar" || peeked.IsNew {
+		t.Errorf("Expected the stored values; Got %#v", peeked.Values)
+	}
+	if _, err = store.PeekByID(context.Background(), "peek-session", "0"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing session; Got %v", err)
 	}
 }
 
 func init() {
 	gob.Register(FlashMessage{})
 }
+
+func Test_StatementsIndependentStores(t *testing.T) {
+	first, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	second, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer second.Close()
+
+	statements := first.Statements()
+	for _, name := range []string{"insert", "update", "select", "delete"} {
+		if statements[name] == "" {
+			t.Errorf("Expected SQL for the %s statement; Got %v", name, statements)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := first.New(req, "first-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = first.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	first.Close()
+	if len(first.Statements()) != 0 {
+		t.Errorf("Expected a closed store to report no statements")
+	}
+
+	session, err = second.New(req, "second-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = second.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Expected the second store to keep working; Got %v", err)
+	}
+	defer second.Delete(httptest.NewRecorder(), session)
+}
+
+func Test_DeleteCookieAttributes(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	newSession := func() *sessions.Session {
+		session, err := store.New(req, "attribute-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		session.Options.Path = "/app"
+		session.Options.Domain = "example.com"
+		session.Options.Secure = true
+		session.Options.HttpOnly = true
+		session.Options.SameSite = http.SameSiteStrictMode
+		return session
+	}
+	cookieOf := func(m *httptest.ResponseRecorder) *http.Cookie {
+		cookies := (&http.Response{Header: m.Header()}).Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("Expected one cookie; Got %d", len(cookies))
+		}
+		return cookies[0]
+	}
+	sameAttributes := func(set, expired *http.Cookie) {
+		if expired.MaxAge >= 0 {
+			t.Errorf("Expected an expiring cookie; Got MaxAge %d", expired.MaxAge)
+		}
+		if set.Path != expired.Path || set.Domain != expired.Domain || set.Secure != expired.Secure ||
+			set.HttpOnly != expired.HttpOnly || set.SameSite != expired.SameSite {
+			t.Errorf("Expected matching attributes; Got %#v and %#v", set, expired)
+		}
+	}
+
+	// Delete
+	session := newSession()
+	m := httptest.NewRecorder()
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	set := cookieOf(m)
+	m = httptest.NewRecorder()
+	if err = store.Delete(m, session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	sameAttributes(set, cookieOf(m))
+
+	// Save with a negative MaxAge
+	session = newSession()
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	session.Options.MaxAge = -1
+	m = httptest.NewRecorder()
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	sameAttributes(set, cookieOf(m))
+	var count int
+	if err = store.db.QueryRow("SELECT count(*) FROM http_sessions WHERE id = $1;", session.ID).Scan(&count); err != nil {
+		t.Fatalf("Error counting rows: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected Save with a negative MaxAge to delete the row")
+	}
+}
+
+func Test_LegacyKeyPairsResave(t *testing.T) {
+	oldStore, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("old-secret-key")}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer oldStore.Close()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := oldStore.New(req, "legacy-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	m := httptest.NewRecorder()
+	if err = oldStore.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer oldStore.Delete(httptest.NewRecorder(), session)
+
+	// the migrating store reads the legacy cookie and data, and re-encodes both on Save
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("new-secret-key")},
+		LegacyKeyPairs: [][]byte{[]byte("old-secret-key")}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	migrated, err := store.New(req, "legacy-session")
+	if err != nil || migrated.IsNew || migrated.Values["foo"] != "bar" {
+		t.Fatalf("Expected the legacy session to load; Got IsNew=%v, %v, %v", migrated.IsNew, migrated.Values, err)
+	}
+	m = httptest.NewRecorder()
+	if err = store.Save(req, m, migrated); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	newStore, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("new-secret-key")}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer newStore.Close()
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	resaved, err := newStore.New(req, "legacy-session")
+	if err != nil || resaved.IsNew || resaved.Values["foo"] != "bar" {
+		t.Errorf("Expected the re-saved session to load with the new keys only; Got IsNew=%v, %v, %v",
+			resaved.IsNew, resaved.Values, err)
+	}
+}
+
+func Test_DeleteAllCookies(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "scoped-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	scopes := []CookieScope{{Path: "/app"}, {Path: "/", Domain: "example.com"}}
+	m := httptest.NewRecorder()
+	if err = store.DeleteAllCookies(m, session, scopes); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	cookies := (&http.Response{Header: m.Header()}).Cookies()
+	if len(cookies) != 3 {
+		t.Fatalf("Expected an expiring cookie per scope plus the current one; Got %d", len(cookies))
+	}
+	for i, scope := range append(scopes, CookieScope{Path: "/"}) {
+		if cookies[i].Path != scope.Path || cookies[i].Domain != scope.Domain || cookies[i].MaxAge >= 0 {
+			t.Errorf("Expected an expiring cookie for %+v; Got %#v", scope, cookies[i])
+		}
+	}
+}
+
+func Test_NewPGStoreFromPool(t *testing.T) {
+	db, err := sql.Open(testDriver, dbUrl)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer db.Close()
+
+	first, err := NewPGStoreFromPool(db, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+	second, err := NewPGStoreFromPool(db, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+	defer second.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := first.New(req, "pooled-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = first.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer second.Delete(httptest.NewRecorder(), session)
+
+	// closing one store leaves both the shared pool and the other store usable
+	first.Close()
+	if err = db.Ping(); err != nil {
+		t.Errorf("Expected the shared pool to stay open; Got %v", err)
+	}
+	if _, err = second.PeekByID(context.Background(), "pooled-session", session.ID); err != nil {
+		t.Errorf("Expected the second store to keep working; Got %v", err)
+	}
+
+	cfg := Config{DB: db, KeyPairs: [][]byte{[]byte("my-secret-key")}, Reconnect: true}
+	if err = cfg.validate(); err == nil {
+		t.Errorf("Expected Reconnect to be rejected for a shared pool")
+	}
+}
+
+func Test_ContextMethods(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.GetContext(ctx, req, "context-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session.Store() != store {
+		t.Errorf("Expected the session to belong to the store; Got %T", session.Store())
+	}
+	session.Values["foo"] = "bar"
+	if err = store.SaveContext(ctx, req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	if _, err = store.NewContext(canceled, req, "context-session"); err == nil {
+		t.Errorf("Expected loading with a canceled context to fail")
+	}
+	if err = store.SaveContext(canceled, req, httptest.NewRecorder(), session); err == nil {
+		t.Errorf("Expected saving with a canceled context to fail")
+	}
+	loaded, err := store.NewContext(ctx, req, "context-session")
+	if err != nil || loaded.IsNew || loaded.Values["foo"] != "bar" {
+		t.Errorf("Expected the saved session with foo=bar; Got IsNew=%v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+	if err = store.DeleteContext(ctx, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+}
+
+func Test_CookieOptionsFunc(t *testing.T) {
+	store := &PGStore{
+		Codecs:  securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		Options: &sessions.Options{Path: "/"},
+		config: Config{CookieOptionsFunc: func(r *http.Request, base *sessions.Options) *sessions.Options {
+			base.Domain = r.Host
+			return base
+		}},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	session, err := store.New(req, "domain-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session.Options.Domain != "example.com" {
+		t.Errorf("Expected Domain example.com; Got %q", session.Options.Domain)
+	}
+	if store.Options.Domain != "" {
+		t.Errorf("Expected the store options to be left alone; Got Domain %q", store.Options.Domain)
+	}
+
+	// a new session with a negative MaxAge only gets its cookie expired, without a database
+	session.Options.MaxAge = -1
+	req, _ = http.NewRequest("GET", "http://other.example.com/", nil)
+	m := httptest.NewRecorder()
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	cookies := (&http.Response{Header: m.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Domain != "other.example.com" {
+		t.Errorf("Expected a cookie for other.example.com; Got %#v", cookies)
+	}
+}
+
+func Test_PeekExpiredSession(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "expired-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["expires_on"] = time.Now().Add(-time.Minute)
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	if _, err = store.PeekByID(context.Background(), "expired-session", session.ID); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected ErrSessionExpired; Got %v", err)
+	}
+}
+
+func Test_MaxLength(t *testing.T) {
+	store := &PGStore{Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key")), MaxLength: 64}
+	session := sessions.NewSession(store, "big-session")
+	session.Values["big"] = strings.Repeat("x", 100)
+	if _, err := store.encodeValues(session); err != ErrValueTooBig {
+		t.Errorf("Expected ErrValueTooBig; Got %v", err)
+	}
+
+	store.SetMaxLength(0)
+	session.Values["big"] = strings.Repeat("x", 10000)
+	if _, err := store.encodeValues(session); err != nil {
+		t.Errorf("Expected no limit after SetMaxLength(0); Got %v", err)
+	}
+}
+
+func Test_NewCopiesAllOptions(t *testing.T) {
+	store := &PGStore{
+		Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		Options: &sessions.Options{
+			Path:     "/app",
+			Domain:   "example.com",
+			MaxAge:   3600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		},
+	}
+	req, _ := http.NewRequest("GET", "http://example.com/app", nil)
+	session, err := store.New(req, "options-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if session.Options == store.Options {
+		t.Errorf("Expected the session to get its own copy of the options")
+	}
+	session.ID = "1"
+	m := httptest.NewRecorder()
+	if err = store.WriteCookie(m, session); err != nil {
+		t.Fatalf("Error writing cookie: %v", err)
+	}
+	header := m.Header().Get("Set-Cookie")
+	for _, attr := range []string{"Path=/app", "Domain=example.com", "Max-Age=3600", "HttpOnly", "Secure", "SameSite=Strict"} {
+		if !strings.Contains(header, attr) {
+			t.Errorf("Expected %s in the Set-Cookie header; Got %s", attr, header)
+		}
+	}
+}
+
+func Test_DuplicateCookies(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	stale, err := store.New(req, "duplicate-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	staleRecorder := httptest.NewRecorder()
+	if err = store.Save(req, staleRecorder, stale); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if err = store.Delete(httptest.NewRecorder(), stale); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+
+	valid, err := store.New(req, "duplicate-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	valid.Values["foo"] = "bar"
+	validRecorder := httptest.NewRecorder()
+	if err = store.Save(req, validRecorder, valid); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), valid)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(staleRecorder.Result().Cookies()[0])
+	req.AddCookie(validRecorder.Result().Cookies()[0])
+	session, status, err := store.GetWithStatus(req, "duplicate-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if status != SessionLoaded || session.ID != valid.ID || session.Values["foo"] != "bar" {
+		t.Errorf("Expected the second cookie's session; Got %s, ID %s, %v", status, session.ID, session.Values)
+	}
+}
+
+func Test_ValuesByID(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, CSRFSecrets: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "values-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	values, err := store.ValuesByID(context.Background(), "values-session", session.ID)
+	if err != nil {
+		t.Fatalf("Error getting values: %v", err)
+	}
+	if len(values) != 1 || values["foo"] != "bar" {
+		t.Errorf("Expected only the stored values; Got %#v", values)
+	}
+	if _, err = store.ValuesByID(context.Background(), "values-session", "0"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a missing session; Got %v", err)
+	}
+}
+
+func Test_DeleteByID(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "delete-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	if err = store.DeleteByID(context.Background(), session.ID); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	if _, err = store.PeekByID(context.Background(), "delete-session", session.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for the deleted session; Got %v", err)
+	}
+	if err = store.DeleteByID(context.Background(), session.ID); err != nil {
+		t.Errorf("Expected deleting a missing session to succeed; Got %v", err)
+	}
+	if _, err = store.DeleteExpired(context.Background()); err != nil {
+		t.Errorf("Error deleting expired sessions: %v", err)
+	}
+}
+
+// scanFailDriver wraps the driver under test and fails reading the result of every INSERT after the statement
+// has run, as a broken connection could.
+type scanFailDriver struct {
+	driver.Driver
+}
+
+func (d scanFailDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return scanFailConn{conn}, nil
+}
+
+type scanFailConn struct {
+	driver.Conn
+}
+
+func (c scanFailConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanFailStmt{Stmt: stmt, insert: strings.HasPrefix(query, "INSERT")}, nil
+}
+
+type scanFailStmt struct {
+	driver.Stmt
+	insert bool
+}
+
+func (s scanFailStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.Stmt.Query(args)
+	if err != nil || !s.insert {
+		return rows, err
+	}
+	return scanFailRows{rows}, nil
+}
+
+type scanFailRows struct {
+	driver.Rows
+}
+
+func (r scanFailRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	return errors.New("forced scan failure")
+}
+
+func init() {
+	db, err := sql.Open(testDriver, "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register("postgres-scanfail", scanFailDriver{db.Driver()})
+}
+
+func Test_InsertScanFailure(t *testing.T) {
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "scanfail_sessions"}
+	plain, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer plain.Close()
+	cfg.DriverName = "postgres-scanfail"
+	failing, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer failing.Close()
+
+	before, err := plain.Count(context.Background())
+	if err != nil {
+		t.Fatalf("Error counting sessions: %v", err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := failing.New(req, "scanfail-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = failing.Save(req, httptest.NewRecorder(), session); err == nil {
+		t.Fatalf("Expected the forced scan failure")
+	}
+	after, err := plain.Count(context.Background())
+	if err != nil {
+		t.Fatalf("Error counting sessions: %v", err)
+	}
+	if after != before {
+		t.Errorf("Expected the failed insert to be rolled back; Got %d sessions instead of %d", after, before)
+	}
+}
+
+func Test_ConcurrentCreateTable(t *testing.T) {
+	db, err := sql.Open(testDriver, dbUrl)
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("DROP TABLE IF EXISTS race_sessions;"); err != nil {
+		t.Fatalf("Error dropping table: %v", err)
+	}
+	defer db.Exec("DROP TABLE IF EXISTS race_sessions;")
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "race_sessions"})
+			if err == nil {
+				store.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected every concurrent constructor to succeed; Got %v", err)
+		}
+	}
+}
+
+func Test_TruncateFunc(t *testing.T) {
+	var overBy int
+	store := &PGStore{
+		Codecs: securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		logger: log.New(io.Discard, "", 0),
+		config: Config{TruncateFunc: func(values map[interface{}]interface{}, over int) {
+			overBy = over
+			delete(values, "big")
+		}},
+	}
+	store.SetMaxLength(1000)
+	session := sessions.NewSession(store, "truncated-session")
+	session.Values["big"] = strings.Repeat("x", 2000)
+	session.Values["small"] = "kept"
+
+	encoded, err := store.encodeValues(session)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	if overBy <= 1000 {
+		t.Errorf("Expected to be told the data is more than 1000 bytes too long; Got %d", overBy)
+	}
+	values := make(map[interface{}]interface{})
+	if err = securecookie.DecodeMulti("truncated-session", encoded, &values, store.Codecs...); err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if _, ok := values["big"]; ok || values["small"] != "kept" {
+		t.Errorf("Expected only the shed key to be missing; Got %v", values)
+	}
+	if _, ok := session.Values["big"]; !ok {
+		t.Errorf("Expected session.Values to be left untouched")
+	}
+
+	// a TruncateFunc that sheds too little gets no second chance
+	calls := 0
+	store.config.TruncateFunc = func(values map[interface{}]interface{}, over int) { calls++ }
+	if _, err = store.encodeValues(session); err != ErrValueTooBig || calls != 1 {
+		t.Errorf("Expected ErrValueTooBig after one call; Got %v after %d calls", err, calls)
+	}
+}
+
+// closeFailDriver hands out connections that cannot be closed, as a leaked or wedged connection
+// might.  It never talks to a database.
+type closeFailDriver struct{}
+
+func (closeFailDriver) Open(name string) (driver.Conn, error) {
+	return closeFailConn{}, nil
+}
+
+type closeFailConn struct{}
+
+func (closeFailConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (closeFailConn) Close() error {
+	return errors.New("forced close failure")
+}
+
+func (closeFailConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func init() {
+	sql.Register("postgres-closefail", closeFailDriver{})
+}
+
+func Test_CloseWithError(t *testing.T) {
+	db, err := sql.Open("postgres-closefail", "")
+	if err != nil {
+		t.Fatalf("Error opening pool: %v", err)
+	}
+	// leaves an idle connection in the pool
+	if err = db.Ping(); err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	var logged bytes.Buffer
+	store := &PGStore{db: db, ownsDB: true, logger: log.New(&logged, "", 0)}
+	err = store.CloseWithError()
+	if err == nil || !strings.Contains(err.Error(), "forced close failure") {
+		t.Errorf("Expected the failure to close the pool to be returned; Got %v", err)
+	}
+
+	db, _ = sql.Open("postgres-closefail", "")
+	db.Ping()
+	store = &PGStore{db: db, ownsDB: true, logger: log.New(&logged, "", 0)}
+	store.Close()
+	if !strings.Contains(logged.String(), "forced close failure") {
+		t.Errorf("Expected Close to log the failure; Got %q", logged.String())
+	}
+}
@@ -0,0 +1,101 @@
+package postgrestore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Predicate is a condition on a column of the sessions table that a row must satisfy to be
+// loaded, in addition to not being expired.  Predicates can only be built with the Column*
+// functions: the column is checked to be a plain identifier and values are always passed as
+// query parameters, so no caller-provided SQL reaches the database.
+type Predicate struct {
+	column string
+	op     string
+	value  interface{}
+	// hasValue is false for operators that take no parameter
+	hasValue bool
+}
+
+// ColumnEquals requires column to equal value, e.g. ColumnEquals("revoked", false).
+func ColumnEquals(column string, value interface{}) Predicate {
+	return Predicate{column: column, op: "=", value: value, hasValue: true}
+}
+
+// ColumnNotEquals requires column to differ from value.  Rows where column is NULL do not match.
+func ColumnNotEquals(column string, value interface{}) Predicate {
+	return Predicate{column: column, op: "<>", value: value, hasValue: true}
+}
+
+// ColumnLessThan requires column to be less than value.
+func ColumnLessThan(column string, value interface{}) Predicate {
+	return Predicate{column: column, op: "<", value: value, hasValue: true}
+}
+
+// ColumnGreaterThan requires column to be greater than value.
+func ColumnGreaterThan(column string, value interface{}) Predicate {
+	return Predicate{column: column, op: ">", value: value, hasValue: true}
+}
+
+// ColumnAfterNow requires the timestamp in column to lie in the future, e.g. a "valid_until"
+// column set by the application.
+func ColumnAfterNow(column string) Predicate {
+	return Predicate{column: column, op: "> now()"}
+}
+
+// ColumnIsNull requires column to be NULL.
+func ColumnIsNull(column string) Predicate {
+	return Predicate{column: column, op: "IS NULL"}
+}
+
+// ColumnIsNotNull requires column not to be NULL.
+func ColumnIsNotNull(column string) Predicate {
+	return Predicate{column: column, op: "IS NOT NULL"}
+}
+
+// validate reports an error for predicates not built with a Column* function or naming an
+// unusable column.
+func (p Predicate) validate() error {
+	if p.op == "" {
+		return errors.New("postgrestore: predicates must be built with a Column function")
+	}
+	if !identifierPattern.MatchString(p.column) {
+		return fmt.Errorf("postgrestore: predicate column %q must be a lower case identifier", p.column)
+	}
+	return nil
+}
+
+// sql renders the predicate, using placeholder $n for its value if it has one.
+func (p Predicate) sql(n int) string {
+	if p.hasValue {
+		return fmt.Sprintf("%s %s $%d", p.column, p.op, n)
+	}
+	return p.column + " " + p.op
+}
+
+// validityClause returns the conditions of the configured validity predicates, to be appended
+// to the select statement's WHERE clause after "id = $1".
+func (dbStore *PGStore) validityClause() string {
+	var clause strings.Builder
+	n := 2
+	for _, p := range dbStore.config.Validity {
+		clause.WriteString(" AND ")
+		clause.WriteString(p.sql(n))
+		if p.hasValue {
+			n++
+		}
+	}
+	return clause.String()
+}
+
+// selectArgs returns the parameters of the select statement for the session id.
+func (dbStore *PGStore) selectArgs(id string) []interface{} {
+	args := []interface{}{id}
+	for _, p := range dbStore.config.Validity {
+		if p.hasValue {
+			args = append(args, p.value)
+		}
+	}
+	return args
+}
@@ -0,0 +1,77 @@
+package postgrestore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_ValidityClause(t *testing.T) {
+	store := &PGStore{config: Config{Validity: []Predicate{
+		ColumnEquals("revoked", false),
+		ColumnAfterNow("valid_until"),
+		ColumnLessThan("generation", 3),
+	}}}
+	if clause := store.validityClause(); clause != " AND revoked = $2 AND valid_until > now() AND generation < $3" {
+		t.Errorf("Unexpected validity clause %q", clause)
+	}
+	if args := store.selectArgs("id"); !reflect.DeepEqual(args, []interface{}{"id", false, 3}) {
+		t.Errorf("Unexpected select arguments %#v", args)
+	}
+}
+
+func Test_PredicateValidation(t *testing.T) {
+	for _, p := range []Predicate{{}, ColumnEquals("revoked = false OR true", true), ColumnIsNull("Revoked")} {
+		if err := p.validate(); err == nil {
+			t.Errorf("Expected an error for predicate %#v", p)
+		}
+	}
+	if err := ColumnIsNotNull("valid_until").validate(); err != nil {
+		t.Errorf("Expected valid_until to be accepted; Got %v", err)
+	}
+}
+
+func Test_ValidityPredicate(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	if _, err = store.db.Exec("ALTER TABLE http_sessions ADD COLUMN IF NOT EXISTS revoked BOOLEAN NOT NULL DEFAULT false;"); err != nil {
+		t.Fatalf("Error adding revoked column: %v", err)
+	}
+	store.Close()
+	store, err = New(Config{
+		DSN:      dbUrl,
+		KeyPairs: [][]byte{[]byte("my-secret-key")},
+		Validity: []Predicate{ColumnEquals("revoked", false)},
+	})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.New(req, "validity-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	if loaded, err := store.New(req, "validity-session"); err != nil || loaded.IsNew {
+		t.Fatalf("Expected the session to load; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+	if _, err = store.db.Exec("UPDATE http_sessions SET revoked = true WHERE id = $1;", session.ID); err != nil {
+		t.Fatalf("Error revoking session: %v", err)
+	}
+	if loaded, _ := store.New(req, "validity-session"); !loaded.IsNew {
+		t.Errorf("Expected the revoked session to be reset")
+	}
+}
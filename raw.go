@@ -0,0 +1,68 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RawMetadata accompanies the raw session data returned by ExportRaw.
+type RawMetadata struct {
+	CreatedOn  time.Time
+	ModifiedOn time.Time
+	ExpiresOn  time.Time
+	// DataKey is the wrapped data key of an envelope encrypted row, or nil.
+	DataKey []byte
+}
+
+// ExportRaw returns the stored data of the session with the given ID exactly as it is held in the
+// database, together with its timestamps.  Nothing is decoded, so no keys are needed; the
+// result can be written back with ImportRaw by anyone holding the same keys.
+func (dbStore *PGStore) ExportRaw(ctx context.Context, id string) ([]byte, RawMetadata, error) {
+	var data []byte
+	var meta RawMetadata
+	err := dbStore.withReconnect(func() error {
+		cols := "data, created_on, modified_on, expires_on"
+		dest := []interface{}{&data, &meta.CreatedOn, zeroIfNull{&meta.ModifiedOn}, &meta.ExpiresOn}
+		if dbStore.kms != nil {
+			cols += ", data_key"
+			dest = append(dest, &meta.DataKey)
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE id = $1%s;", cols, dbStore.table, dbStore.tenantCondition(2))
+		return dbStore.db.QueryRowContext(ctx, query, append([]interface{}{id}, dbStore.tenantArgs()...)...).Scan(dest...)
+	})
+	if err != nil {
+		return nil, RawMetadata{}, classify(err)
+	}
+	return data, meta, nil
+}
+
+// ImportRaw inserts data and its metadata, as returned by ExportRaw, verbatim as a new session
+// and returns the new session's ID.  It is the one place where "created_on" can be set by the
+// caller; Save always stamps new sessions with the current time.
+func (dbStore *PGStore) ImportRaw(ctx context.Context, data []byte, meta RawMetadata) (string, error) {
+	if meta.DataKey != nil && dbStore.kms == nil {
+		return "", errors.New("postgrestore: importing an envelope encrypted session requires a KMS")
+	}
+	cols := []string{"data", "created_on", "modified_on", "expires_on"}
+	args := []interface{}{data, meta.CreatedOn, nullIfZero(meta.ModifiedOn), meta.ExpiresOn}
+	if meta.DataKey != nil {
+		cols = append(cols, "data_key")
+		args = append(args, meta.DataKey)
+	}
+	cols, args, err := dbStore.newRow(cols, args)
+	if err != nil {
+		return "", err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id;", dbStore.table, strings.Join(cols, ", "), placeholders(len(cols)))
+	var id string
+	err = dbStore.withReconnectWrite(func() error {
+		return dbStore.db.QueryRowContext(ctx, query, args...).Scan(&id)
+	})
+	if err != nil {
+		return "", classify(err)
+	}
+	return id, nil
+}
@@ -0,0 +1,54 @@
+package postgrestore
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_ExportImportRaw(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "raw-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	data, meta, err := store.ExportRaw(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Error exporting session: %v", err)
+	}
+	id, err := store.ImportRaw(ctx, data, meta)
+	if err != nil {
+		t.Fatalf("Error importing session: %v", err)
+	}
+	defer store.stmtDelete.Exec(id)
+	if id == session.ID {
+		t.Errorf("Expected the import to create a new row")
+	}
+
+	clonedData, clonedMeta, err := store.ExportRaw(ctx, id)
+	if err != nil {
+		t.Fatalf("Error exporting clone: %v", err)
+	}
+	if !bytes.Equal(data, clonedData) || !clonedMeta.CreatedOn.Equal(meta.CreatedOn) {
+		t.Errorf("Expected the clone to match the original verbatim")
+	}
+	clone, err := store.PeekByID(ctx, "raw-session", id)
+	if err != nil || clone.Values["foo"] != "bar" {
+		t.Errorf("Expected the clone to decode; Got %v, %v", clone, err)
+	}
+}
@@ -0,0 +1,121 @@
+package postgrestore
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// defaultReconnectBackoff is the minimum time between two pool rebuilds when
+// Config.ReconnectBackoff is not set.
+const defaultReconnectBackoff = 5 * time.Second
+
+// errReconnectBackoff is returned by rebuild when the previous rebuild happened too recently.
+var errReconnectBackoff = errors.New("postgrestore: pool was rebuilt too recently")
+
+// defaultDriverName is the lib/pq driver used when Config.DriverName is not set.  The tests
+// point it at the driver under test.
+var defaultDriverName = "postgres"
+
+// defaultMaxIdleConns is database/sql's idle connection limit when none is set.
+const defaultMaxIdleConns = 2
+
+// openDB opens a connection pool for cfg.DSN with cfg.DriverName and applies the pool settings of cfg.
+func openDB(cfg Config) (*sql.DB, error) {
+	dsn, err := withDSNParams(cfg.DSN, dsnParams(cfg))
+	if err != nil {
+		return nil, err
+	}
+	driverName := cfg.DriverName
+	if driverName == "" {
+		driverName = defaultDriverName
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	} else if cfg.WarmupConnections > defaultMaxIdleConns {
+		// Keep the warmed up connections, database/sql would close all but two of them again.
+		db.SetMaxIdleConns(cfg.WarmupConnections)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	return db, nil
+}
+
+// withReconnect runs op, which may use the pool and the prepared statements, while holding the
+// read lock.  With Config.Reconnect set, an error that leaves the database unreachable causes the
+// pool to be rebuilt and op to be retried once against the new pool.  op must be safe to run
+// twice: a read, or a write whose repetition changes nothing.
+func (dbStore *PGStore) withReconnect(op func() error) error {
+	return dbStore.reconnect(op, isUnavailable)
+}
+
+// withReconnectWrite is withReconnect for statements that must not run twice, such as inserts,
+// counter increments and deletes that report or return what they removed.  The pool is rebuilt
+// all the same, but op is only retried if its error shows that the statement never reached the
+// server: a connection that broke while waiting for the reply may have committed it.
+func (dbStore *PGStore) withReconnectWrite(op func() error) error {
+	return dbStore.reconnect(op, notSent)
+}
+
+// reconnect implements withReconnect, retrying op after a rebuild if retry accepts its error.
+func (dbStore *PGStore) reconnect(op func() error, retry func(error) bool) error {
+	dbStore.mu.RLock()
+	err := op()
+	dbStore.mu.RUnlock()
+	if !dbStore.config.Reconnect || !isUnavailable(err) {
+		return err
+	}
+	if rebuildErr := dbStore.rebuild(); rebuildErr != nil {
+		dbStore.logger.Printf("Unable to rebuild the connection pool: %s", rebuildErr)
+		return err
+	}
+	if !retry(err) {
+		return err
+	}
+	dbStore.mu.RLock()
+	defer dbStore.mu.RUnlock()
+	return op()
+}
+
+// rebuild replaces the connection pool with a new one opened from the configured DSN and
+// re-prepares all statements against it.  Rebuilds are at least Config.ReconnectBackoff apart so
+// an outage does not turn into a storm of reconnects; the store keeps its old pool if the new
+// one cannot be set up.
+func (dbStore *PGStore) rebuild() error {
+	dbStore.mu.Lock()
+	defer dbStore.mu.Unlock()
+	backoff := dbStore.config.ReconnectBackoff
+	if backoff == 0 {
+		backoff = defaultReconnectBackoff
+	}
+	if time.Since(dbStore.lastRebuild) < backoff {
+		return errReconnectBackoff
+	}
+	dbStore.lastRebuild = time.Now()
+	db, err := openDB(dbStore.config)
+	if err != nil {
+		return err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+	old := dbStore.db
+	dbStore.db = db
+	if err = dbStore.prepare(); err != nil {
+		dbStore.db = old
+		db.Close()
+		return err
+	}
+	old.Close()
+	dbStore.logger.Printf("Rebuilt the session store connection pool")
+	return nil
+}
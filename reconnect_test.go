@@ -0,0 +1,82 @@
+package postgrestore
+
+import (
+	"database/sql/driver"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_ReconnectBackoff(t *testing.T) {
+	store := &PGStore{
+		config:      Config{Reconnect: true, ReconnectBackoff: time.Hour},
+		lastRebuild: time.Now(),
+		logger:      log.New(io.Discard, "", 0),
+	}
+	if err := store.rebuild(); err != errReconnectBackoff {
+		t.Fatalf("Expected errReconnectBackoff; Got %v", err)
+	}
+	calls := 0
+	err := store.withReconnect(func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if err != driver.ErrBadConn || calls != 1 {
+		t.Errorf("Expected one failed call while backing off; Got %d calls and %v", calls, err)
+	}
+}
+
+func Test_ReconnectAfterPoolClosed(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Reconnect: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	// pull the pool out from under the store
+	store.db.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "reconnect-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Expected the save to succeed after a rebuild; Got %v", err)
+	}
+	if err = store.Delete(httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+}
+
+func Test_ReconnectWriteNotRetried(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Reconnect: true, ReconnectBackoff: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	// the connection broke after the statement may have been sent
+	calls := 0
+	err = store.withReconnectWrite(func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if err != driver.ErrBadConn || calls != 1 {
+		t.Errorf("Expected a write to be tried once; Got %d calls and %v", calls, err)
+	}
+	calls = 0
+	err = store.withReconnect(func() error {
+		calls++
+		if calls == 1 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Expected a read to be retried after the rebuild; Got %d calls and %v", calls, err)
+	}
+}
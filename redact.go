@@ -0,0 +1,30 @@
+package postgrestore
+
+import (
+	"strings"
+)
+
+// redactedID replaces session IDs in log lines when no Redactor is configured.
+const redactedID = "[redacted]"
+
+// MaskSessionID returns a Redactor that replaces all but the last keep characters of a session
+// ID with asterisks, e.g. "****1234" for keep 4, so log lines can still be correlated.
+func MaskSessionID(keep int) func(id string) string {
+	return func(id string) string {
+		if keep <= 0 {
+			return strings.Repeat("*", len(id))
+		}
+		if len(id) <= keep {
+			return id
+		}
+		return strings.Repeat("*", len(id)-keep) + id[len(id)-keep:]
+	}
+}
+
+// redact returns id as it may appear in log lines and error messages.
+func (dbStore *PGStore) redact(id string) string {
+	if dbStore.config.Redactor == nil {
+		return redactedID
+	}
+	return dbStore.config.Redactor(id)
+}
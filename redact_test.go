@@ -0,0 +1,56 @@
+package postgrestore
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_MaskSessionID(t *testing.T) {
+	cases := []struct {
+		keep int
+		id   string
+		want string
+	}{
+		{4, "123456789", "*****6789"},
+		{4, "123", "123"},
+		{0, "1234", "****"},
+	}
+	for _, c := range cases {
+		if got := MaskSessionID(c.keep)(c.id); got != c.want {
+			t.Errorf("MaskSessionID(%d)(%q): Expected %q; Got %q", c.keep, c.id, c.want, got)
+		}
+	}
+}
+
+func Test_RedactedLogLines(t *testing.T) {
+	var buf bytes.Buffer
+	store := &PGStore{
+		config: Config{
+			Fingerprint:           func(r *http.Request) string { return r.UserAgent() },
+			FingerprintStrictness: FingerprintWarn,
+		},
+		logger: log.New(&buf, "", 0),
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	stored := sql.NullString{String: "other-device", Valid: true}
+
+	if err := store.checkFingerprint(req, "987654321", stored); err != nil {
+		t.Fatalf("Error checking fingerprint: %v", err)
+	}
+	if strings.Contains(buf.String(), "987654321") || !strings.Contains(buf.String(), redactedID) {
+		t.Errorf("Expected the session ID to be redacted; Got %q", buf.String())
+	}
+
+	buf.Reset()
+	store.config.Redactor = MaskSessionID(4)
+	if err := store.checkFingerprint(req, "987654321", stored); err != nil {
+		t.Fatalf("Error checking fingerprint: %v", err)
+	}
+	if !strings.Contains(buf.String(), "*****4321") {
+		t.Errorf("Expected the masked session ID; Got %q", buf.String())
+	}
+}
@@ -0,0 +1,89 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"strings"
+	"time"
+)
+
+// defaultReservationTTL is how long a reserved session ID stays valid when
+// Config.ReservationTTL is not set.
+const defaultReservationTTL = 10 * time.Minute
+
+// ErrNoReservation is returned by CommitSession when there is no uncommitted reservation for the
+// given ID, either because it was never reserved, has expired, or was already committed.
+var ErrNoReservation = errors.New("postgrestore: no pending reservation for this session ID")
+
+// ReserveID inserts a placeholder row and returns its ID, for flows that need a session ID
+// before the session content exists (e.g. an OAuth state parameter).  The reservation holds no
+// data and cannot be loaded; it expires after Config.ReservationTTL unless CommitSession fills
+// it in first.
+func (dbStore *PGStore) ReserveID(ctx context.Context) (string, error) {
+	ttl := dbStore.config.ReservationTTL
+	if ttl == 0 {
+		ttl = defaultReservationTTL
+	}
+	now := time.Now()
+	cols, args, err := dbStore.newRow([]string{"data", "created_on", "modified_on", "expires_on"},
+		[]interface{}{[]byte{}, now, dbStore.insertModifiedOn(now), now.Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = dbStore.withReconnectWrite(func() error {
+		return dbStore.db.QueryRowContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id;", dbStore.table, strings.Join(cols, ", "), placeholders(len(cols))),
+			args...).Scan(&id)
+	})
+	if err != nil {
+		return "", classify(err)
+	}
+	return id, nil
+}
+
+// CommitSession stores values in a reservation made by ReserveID and gives it the normal expiry
+// of the store's Options.MaxAge.  name is the session (cookie) name the data is encoded for, as
+// passed to Get later on.
+func (dbStore *PGStore) CommitSession(ctx context.Context, name string, id string, values map[interface{}]interface{}) error {
+	session := sessions.NewSession(dbStore, name)
+	session.Values = values
+	encoded, err := dbStore.encodeValues(session)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expiresOn := now.Add(time.Second * time.Duration(dbStore.Options.MaxAge))
+	var data, dataKey interface{} = []byte(encoded), nil
+	if dbStore.kms != nil {
+		if data, dataKey, err = dbStore.sealFor(ctx, session, encoded); err != nil {
+			return err
+		}
+	}
+	var n int64
+	err = dbStore.withReconnect(func() error {
+		set := "data = $1, modified_on = $2, expires_on = $3"
+		args := []interface{}{data, now, expiresOn, id}
+		if dbStore.kms != nil {
+			set += ", data_key = $5"
+			args = append(args, dataKey)
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = $4 AND data = '' AND expires_on > $2%s;",
+			dbStore.table, set, dbStore.tenantCondition(len(args)+1))
+		args = append(args, dbStore.tenantArgs()...)
+		res, err := dbStore.db.ExecContext(ctx, query, args...)
+		if err == nil {
+			n, err = res.RowsAffected()
+		}
+		return err
+	})
+	if err != nil {
+		return classify(err)
+	}
+	if n == 0 {
+		return ErrNoReservation
+	}
+	return nil
+}
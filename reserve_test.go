@@ -0,0 +1,40 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func Test_ReserveAndCommit(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	id, err := store.ReserveID(ctx)
+	if err != nil {
+		t.Fatalf("Error reserving ID: %v", err)
+	}
+	defer store.stmtDelete.Exec(id)
+	if _, err = store.PeekByID(ctx, "reserved-session", id); err != sql.ErrNoRows {
+		t.Errorf("Expected an uncommitted reservation to be unloadable; Got %v", err)
+	}
+
+	values := map[interface{}]interface{}{"state": "xyz"}
+	if err = store.CommitSession(ctx, "reserved-session", id, values); err != nil {
+		t.Fatalf("Error committing session: %v", err)
+	}
+	session, err := store.PeekByID(ctx, "reserved-session", id)
+	if err != nil {
+		t.Fatalf("Error loading committed session: %v", err)
+	}
+	if session.Values["state"] != "xyz" {
+		t.Errorf("Expected state=xyz; Got %#v", session.Values)
+	}
+	if err = store.CommitSession(ctx, "reserved-session", id, values); err != ErrNoReservation {
+		t.Errorf("Expected ErrNoReservation when committing twice; Got %v", err)
+	}
+}
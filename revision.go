@@ -0,0 +1,38 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errRevisionsDisabled is returned by Revision when the store was built without Config.Revisions.
+var errRevisionsDisabled = errors.New("postgrestore: revisions are not enabled for this store")
+
+// addRevisionColumn adds the "revision" column if it is missing.
+func (dbStore *PGStore) addRevisionColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 0;", dbStore.table))
+	if err != nil {
+		return fmt.Errorf("Unable to add revision column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// Revision returns the revision of the session with the given ID.  It starts at 0 and is
+// incremented by every update, so a handler can derive an ETag from the session ID and the
+// revision and answer conditional requests with 304 Not Modified while the session is unchanged.
+// Missing sessions are reported with sql.ErrNoRows.
+func (dbStore *PGStore) Revision(ctx context.Context, id string) (int64, error) {
+	if !dbStore.config.Revisions {
+		return 0, errRevisionsDisabled
+	}
+	var revision int64
+	err := dbStore.withReconnect(func() error {
+		return dbStore.db.QueryRowContext(ctx, fmt.Sprintf("SELECT revision FROM %s WHERE id = $1%s;", dbStore.table, dbStore.tenantCondition(2)),
+			append([]interface{}{id}, dbStore.tenantArgs()...)...).Scan(&revision)
+	})
+	if err != nil {
+		return 0, classify(err)
+	}
+	return revision, nil
+}
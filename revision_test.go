@@ -0,0 +1,46 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Revision(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Revisions: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "revision-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	revision, err := store.Revision(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Error reading revision: %v", err)
+	}
+	if revision != 0 {
+		t.Errorf("Expected a new session to be at revision 0; Got %d", revision)
+	}
+	for i := 0; i < 2; i++ {
+		if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+	}
+	if revision, err = store.Revision(ctx, session.ID); err != nil {
+		t.Fatalf("Error reading revision: %v", err)
+	}
+	if revision != 2 {
+		t.Errorf("Expected revision 2 after two updates; Got %d", revision)
+	}
+}
@@ -0,0 +1,145 @@
+package postgrestore
+
+import (
+	"context"
+	"strings"
+)
+
+// SchemaMismatchError is returned by VerifySchema when the database lacks objects the store's
+// configuration relies on.
+type SchemaMismatchError struct {
+	MissingTables  []string
+	MissingColumns []string
+	MissingIndexes []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	var parts []string
+	if len(e.MissingTables) > 0 {
+		parts = append(parts, "missing tables: "+strings.Join(e.MissingTables, ", "))
+	}
+	if len(e.MissingColumns) > 0 {
+		parts = append(parts, "missing columns: "+strings.Join(e.MissingColumns, ", "))
+	}
+	if len(e.MissingIndexes) > 0 {
+		parts = append(parts, "missing indexes: "+strings.Join(e.MissingIndexes, ", "))
+	}
+	return "postgrestore: schema does not match the configuration; " + strings.Join(parts, "; ")
+}
+
+// expectedSchema lists the tables, sessions table columns and indexes the configuration relies on.
+func (dbStore *PGStore) expectedSchema() (tables, columns, indexes []string) {
+	tables = []string{dbStore.unqualify(dbStore.table)}
+	columns = []string{"id", "data", "created_on", "modified_on", "expires_on"}
+	if dbStore.csrfSecrets {
+		columns = append(columns, "csrf_secret")
+	}
+	if dbStore.kms != nil {
+		columns = append(columns, "data_key")
+	}
+	if dbStore.tags {
+		columns = append(columns, "tags")
+		indexes = append(indexes, dbStore.indexName("tags"))
+	}
+	if dbStore.config.Fingerprint != nil {
+		columns = append(columns, "fingerprint")
+	}
+	if dbStore.config.IdleTimeout > 0 {
+		columns = append(columns, "last_accessed_at")
+	}
+	if dbStore.config.Revisions {
+		columns = append(columns, "revision")
+	}
+	if dbStore.config.GlobalGeneration {
+		tables = append(tables, dbStore.unqualify(dbStore.companionName("generation")))
+		columns = append(columns, "global_generation")
+	}
+	if dbStore.config.GraceDeleteWindow > 0 {
+		columns = append(columns, "delete_after")
+	}
+	if dbStore.config.LocaleColumns {
+		columns = append(columns, "locale", "timezone")
+		indexes = append(indexes, dbStore.indexName("locale"), dbStore.indexName("timezone"))
+	}
+	if dbStore.config.CreationContext != nil {
+		columns = append(columns, "creation_context")
+	}
+	if dbStore.config.MaxSessionsPerIP > 0 {
+		columns = append(columns, "ip_address")
+		indexes = append(indexes, dbStore.indexName("ip_address"))
+	}
+	if dbStore.config.Tenant != "" {
+		columns = append(columns, "tenant")
+		indexes = append(indexes, dbStore.indexName("tenant_expires_on"))
+	}
+	if dbStore.config.FlashTable {
+		tables = append(tables, dbStore.unqualify(dbStore.companionName("flashes")))
+	}
+	for _, col := range dbStore.config.Indexes.columns() {
+		indexes = append(indexes, dbStore.indexName(col))
+	}
+	return tables, columns, indexes
+}
+
+// VerifySchema checks that the tables, columns and indexes the store's configuration relies on
+// exist in Config.Schema, or on the search_path, and returns a *SchemaMismatchError listing
+// whatever is missing.  Run it at startup to catch a table set up under a different
+// configuration, e.g. by another service, before queries start failing with "column does not
+// exist".  Objects the configuration does not use are ignored.  It only reads the catalog.
+func (dbStore *PGStore) VerifySchema(ctx context.Context) error {
+	tables, columns, indexes := dbStore.expectedSchema()
+	mismatch := &SchemaMismatchError{}
+	err := dbStore.withReconnect(func() error {
+		*mismatch = SchemaMismatchError{}
+		var err error
+		table := dbStore.unqualify(dbStore.table)
+		cond, args := inSchema("table_schema", dbStore.schema, 1)
+		if mismatch.MissingTables, err = dbStore.missing(ctx, "SELECT table_name FROM information_schema.tables "+
+			"WHERE "+cond+";", tables, args...); err != nil {
+			return err
+		}
+		cond, args = inSchema("table_schema", dbStore.schema, 2)
+		if mismatch.MissingColumns, err = dbStore.missing(ctx, "SELECT column_name FROM information_schema.columns "+
+			"WHERE table_name = $1 AND "+cond+";", columns, append([]interface{}{table}, args...)...); err != nil {
+			return err
+		}
+		cond, args = inSchema("schemaname", dbStore.schema, 2)
+		mismatch.MissingIndexes, err = dbStore.missing(ctx, "SELECT indexname FROM pg_indexes "+
+			"WHERE tablename = $1 AND "+cond+";", indexes, append([]interface{}{table}, args...)...)
+		return err
+	})
+	if err != nil {
+		return classify(err)
+	}
+	if len(mismatch.MissingTables)+len(mismatch.MissingColumns)+len(mismatch.MissingIndexes) > 0 {
+		return mismatch
+	}
+	return nil
+}
+
+// missing returns the names in expected that are not among the names returned by query.
+func (dbStore *PGStore) missing(ctx context.Context, query string, expected []string, args ...interface{}) ([]string, error) {
+	rows, err := dbStore.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	present := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		present[name] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	var absent []string
+	for _, name := range expected {
+		if !present[name] {
+			absent = append(absent, name)
+		}
+	}
+	return absent, nil
+}
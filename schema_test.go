@@ -0,0 +1,37 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_VerifySchema(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Tags: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err = store.VerifySchema(ctx); err != nil {
+		t.Fatalf("Expected the schema created by New to verify; Got %v", err)
+	}
+
+	// a configuration the table was not set up for
+	store.config.Revisions = true
+	store.config.Indexes = IndexConfig{ModifiedOn: true}
+	store.db.Exec("DROP INDEX IF EXISTS http_sessions_modified_on_idx;")
+	err = store.VerifySchema(ctx)
+	var mismatch *SchemaMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a SchemaMismatchError; Got %v", err)
+	}
+	if !containsID(mismatch.MissingIndexes, "http_sessions_modified_on_idx") {
+		t.Errorf("Expected the modified_on index to be reported; Got %v", mismatch)
+	}
+	if !strings.Contains(err.Error(), "http_sessions_modified_on_idx") {
+		t.Errorf("Expected the error message to name the index; Got %s", err)
+	}
+}
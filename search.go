@@ -0,0 +1,155 @@
+package postgrestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"reflect"
+)
+
+// searchBatchSize is the number of rows SearchByValue reads per query.
+const searchBatchSize = 500
+
+// defaultSearchScanLimit is the Config.SearchScanLimit used when none is set.
+const defaultSearchScanLimit = 100000
+
+// ErrSearchIncomplete is returned by SearchByValue, along with the IDs found so far, when it
+// stopped after Config.SearchScanLimit sessions without reaching the end of the table.
+var ErrSearchIncomplete = errors.New("postgrestore: search stopped at the scan limit")
+
+// SearchByValue returns the IDs of the active sessions with the given name whose Values[key]
+// equals value, as compared by reflect.DeepEqual after decoding, e.g. to find the session
+// holding an order ID for a support request when no column carries it.
+//
+// This is a full scan that decodes, and with a KMS or FieldEncryptor decrypts, every active
+// session, so it is meant for occasional use by support tooling and never for the request path.
+// Rows are read in batches of a few hundred by ID, in separate short queries, and the scan stops
+// with ErrSearchIncomplete after Config.SearchScanLimit sessions.  Cancel ctx to stop it earlier.
+// Rows that cannot be decoded, e.g. those of other session names, are skipped.
+//
+// With JSONSerializer, and without a KMS, FieldEncryptor or Compressor, the comparison is done by
+// Postgres on the JSON document instead, which an expression index on
+// (convert_from(data, 'UTF8')::jsonb -> 'key') turns into an index lookup.  Every row must then
+// hold JSON, or the query fails; tables still holding rows from another serializer are searched
+// by scanning once a Compressor is set.
+func (dbStore *PGStore) SearchByValue(ctx context.Context, name, key string, value interface{}) ([]string, error) {
+	if _, ok := dbStore.Serializer.(JSONSerializer); ok && dbStore.kms == nil &&
+		dbStore.config.FieldEncryptor == nil && dbStore.config.Compressor == nil {
+		return dbStore.searchJSON(ctx, key, value)
+	}
+	limit := dbStore.config.SearchScanLimit
+	if limit <= 0 {
+		limit = defaultSearchScanLimit
+	}
+	var ids []string
+	var after string
+	for scanned := 0; scanned < limit; {
+		if err := ctx.Err(); err != nil {
+			return ids, err
+		}
+		batch := searchBatchSize
+		if limit-scanned < batch {
+			batch = limit - scanned
+		}
+		rows, err := dbStore.searchBatch(ctx, after, batch)
+		if err != nil {
+			return ids, err
+		}
+		for _, row := range rows {
+			session := sessions.NewSession(dbStore, name)
+			session.ID = row.id
+			if _, err = dbStore.decodeStored(ctx, session, row.data, row.dataKey); err != nil {
+				continue
+			}
+			if found, ok := session.Values[key]; ok && reflect.DeepEqual(found, value) {
+				ids = append(ids, session.ID)
+			}
+		}
+		if len(rows) < batch {
+			return ids, nil
+		}
+		after = rows[len(rows)-1].id
+		scanned += len(rows)
+	}
+	return ids, ErrSearchIncomplete
+}
+
+// searchRow is a row read by searchBatch.
+type searchRow struct {
+	id      string
+	data    string
+	dataKey []byte
+}
+
+// searchBatch reads up to limit active sessions with an ID greater than after, or from the
+// first one if after is empty, in ID order.
+func (dbStore *PGStore) searchBatch(ctx context.Context, after string, limit int) ([]searchRow, error) {
+	cols := "id, data, NULL::BYTEA"
+	if dbStore.kms != nil {
+		cols = "id, data, data_key"
+	}
+	cond, args := "", []interface{}{limit}
+	if after != "" {
+		cond, args = "id > $2 AND ", append(args, after)
+	}
+	tenant := dbStore.tenantCondition(len(args) + 1)
+	args = append(args, dbStore.tenantArgs()...)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %sdata <> '' AND expires_on > now()%s "+
+		"ORDER BY id LIMIT $1;", cols, dbStore.table, cond, tenant)
+	var batch []searchRow
+	err := dbStore.withReconnect(func() error {
+		batch = nil
+		rows, err := dbStore.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var row searchRow
+			if err = rows.Scan(&row.id, &row.data, &row.dataKey); err != nil {
+				return err
+			}
+			batch = append(batch, row)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return batch, nil
+}
+
+// searchJSON implements SearchByValue for JSON session data by comparing the JSON documents in
+// Postgres.  The value is compared after a JSON round trip, so e.g. the int 42 matches the stored
+// number 42.
+func (dbStore *PGStore) searchJSON(ctx context.Context, key string, value interface{}) ([]string, error) {
+	want, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT id FROM %s WHERE data <> '' AND expires_on > now() "+
+		"AND convert_from(data, 'UTF8')::jsonb -> $1 = $2::jsonb%s ORDER BY id;", dbStore.table, dbStore.tenantCondition(3))
+	var ids []string
+	err = dbStore.withReconnect(func() error {
+		ids = nil
+		rows, err := dbStore.db.QueryContext(ctx, query, append([]interface{}{key, string(want)}, dbStore.tenantArgs()...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,70 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_SearchByValue(t *testing.T) {
+	for _, cfg := range []Config{
+		{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, SearchScanLimit: 1000},
+		{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Serializer: JSONSerializer{}, TableName: "json_sessions"},
+	} {
+		store, err := New(cfg)
+		if err != nil {
+			t.Fatalf("failed to open a database connection: %#v", err)
+		}
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		var ids []string
+		for _, order := range []string{"order-1", "order-2"} {
+			session, err := store.New(req, "search-session")
+			if err != nil {
+				t.Fatalf("Error getting session: %v", err)
+			}
+			session.Values["order"] = order
+			if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+				t.Fatalf("Error saving session: %v", err)
+			}
+			defer store.Delete(httptest.NewRecorder(), session)
+			ids = append(ids, session.ID)
+		}
+
+		found, err := store.SearchByValue(context.Background(), "search-session", "order", "order-2")
+		if err != nil {
+			t.Fatalf("Error searching sessions: %v", err)
+		}
+		if len(found) != 1 || found[0] != ids[1] {
+			t.Errorf("Expected session %s; Got %v", ids[1], found)
+		}
+		if found, err = store.SearchByValue(context.Background(), "search-session", "order", "order-3"); err != nil || len(found) != 0 {
+			t.Errorf("Expected no match; Got %v, %v", found, err)
+		}
+	}
+}
+
+func Test_SearchScanLimit(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, SearchScanLimit: 1})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	for i := 0; i < 2; i++ {
+		session, err := store.New(req, "search-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		defer store.Delete(httptest.NewRecorder(), session)
+	}
+	if _, err = store.SearchByValue(context.Background(), "search-session", "order", "order-1"); err != ErrSearchIncomplete {
+		t.Errorf("Expected ErrSearchIncomplete; Got %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package postgrestore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Serializer turns session.Values into the bytes stored in the "data" column and back.  The
+// session passed to Serialize holds a copy of the values without the metadata keys.
+type Serializer interface {
+	Serialize(session *sessions.Session) ([]byte, error)
+	Deserialize(data []byte, session *sessions.Session) error
+}
+
+// GobSerializer stores session.Values gob encoded.  As with securecookie, custom types must be
+// registered with gob.Register.
+type GobSerializer struct{}
+
+// Serialize implements Serializer.
+func (GobSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize implements Serializer.
+func (GobSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values)
+}
+
+// JSONSerializer stores session.Values as a JSON object, so the data can be inspected and
+// queried in Postgres, e.g. with convert_from(data, 'UTF8')::jsonb.  Values come back as the
+// types encoding/json decodes into interface{}: numbers are float64, objects
+// map[string]interface{} and arrays []interface{}, unless the key is registered in Types.
+//
+// Types registers the Go type of the value stored under a key, given as a value of that type,
+// e.g. Types: map[string]interface{}{"user": User{}} or {"user": &User{}}.  The value is still
+// marshalled by encoding/json, so its JSON field names are those of its json struct tags, or
+// of its json.Marshaler, which keeps the stored JSON stable for other services reading the
+// table; on load it is unmarshalled into a new value of the registered type instead of a
+// map[string]interface{}.  Only exported fields are stored, and a value of any other type
+// under a registered key is reported as an error when saving, so that readers can rely on the
+// shape.  A null value is loaded as nil.  Types only applies to string keys.
+//
+// Keys must be strings unless CoerceKeys is set, in which case keys of the predeclared types
+// bool, int, int8 through int64, uint, uint8 through uint64, float32, float64 and string are
+// stored as strings tagged with their type, e.g. "\x00int:42", and come back as the same type
+// and value.  Keys of any other type, including named types such as "type key int", are
+// reported as errors rather than converted lossily.  Plain string keys are stored as they are,
+// except for those starting with a NUL character, which are tagged as well.
+type JSONSerializer struct {
+	CoerceKeys bool
+	Types      map[string]interface{}
+}
+
+// keyTag starts the JSON keys coerced from non-string keys.
+const keyTag = "\x00"
+
+// Serialize implements Serializer.  Values that cannot be marshalled to JSON are reported as
+// errors.
+func (s JSONSerializer) Serialize(session *sessions.Session) ([]byte, error) {
+	values := make(map[string]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		name, ok := key.(string)
+		if s.CoerceKeys {
+			var err error
+			if name, err = encodeKey(key); err != nil {
+				return nil, err
+			}
+		} else if !ok {
+			return nil, fmt.Errorf("postgrestore: JSONSerializer requires string keys, got %T", key)
+		}
+		if typ, registered, err := s.typeOf(key); err != nil {
+			return nil, err
+		} else if registered && value != nil && reflect.TypeOf(value) != typ {
+			return nil, fmt.Errorf("postgrestore: JSONSerializer expects %s for key %q, got %T", typ, key, value)
+		}
+		values[name] = value
+	}
+	return json.Marshal(values)
+}
+
+// Deserialize implements Serializer.
+func (s JSONSerializer) Deserialize(data []byte, session *sessions.Session) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for name, raw := range values {
+		var key interface{} = name
+		if s.CoerceKeys {
+			var err error
+			if key, err = decodeKey(name); err != nil {
+				return err
+			}
+		}
+		typ, registered, err := s.typeOf(key)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if registered && string(raw) != "null" {
+			value, err = decodeTyped(raw, typ)
+		} else {
+			err = json.Unmarshal(raw, &value)
+		}
+		if err != nil {
+			return fmt.Errorf("postgrestore: unable to decode key %q: %w", name, err)
+		}
+		session.Values[key] = value
+	}
+	return nil
+}
+
+// typeOf returns the type registered in Types for key, if any.
+func (s JSONSerializer) typeOf(key interface{}) (reflect.Type, bool, error) {
+	name, ok := key.(string)
+	if !ok {
+		return nil, false, nil
+	}
+	prototype, ok := s.Types[name]
+	if !ok {
+		return nil, false, nil
+	}
+	if prototype == nil {
+		return nil, false, fmt.Errorf("postgrestore: JSONSerializer.Types[%q] must be a value of the registered type, not nil", name)
+	}
+	return reflect.TypeOf(prototype), true, nil
+}
+
+// decodeTyped unmarshals raw into a new value of typ.
+func decodeTyped(raw json.RawMessage, typ reflect.Type) (interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		value := reflect.New(typ.Elem())
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return nil, err
+		}
+		return value.Interface(), nil
+	}
+	value := reflect.New(typ)
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// encodeKey turns a session.Values key into a JSON object key; see JSONSerializer.
+func encodeKey(key interface{}) (string, error) {
+	var typ, value string
+	switch k := key.(type) {
+	case string:
+		if !strings.HasPrefix(k, keyTag) {
+			return k, nil
+		}
+		typ, value = "string", k
+	case bool:
+		typ, value = "bool", strconv.FormatBool(k)
+	case int:
+		typ, value = "int", strconv.FormatInt(int64(k), 10)
+	case int8:
+		typ, value = "int8", strconv.FormatInt(int64(k), 10)
+	case int16:
+		typ, value = "int16", strconv.FormatInt(int64(k), 10)
+	case int32:
+		typ, value = "int32", strconv.FormatInt(int64(k), 10)
+	case int64:
+		typ, value = "int64", strconv.FormatInt(k, 10)
+	case uint:
+		typ, value = "uint", strconv.FormatUint(uint64(k), 10)
+	case uint8:
+		typ, value = "uint8", strconv.FormatUint(uint64(k), 10)
+	case uint16:
+		typ, value = "uint16", strconv.FormatUint(uint64(k), 10)
+	case uint32:
+		typ, value = "uint32", strconv.FormatUint(uint64(k), 10)
+	case uint64:
+		typ, value = "uint64", strconv.FormatUint(k, 10)
+	case float32:
+		typ, value = "float32", strconv.FormatFloat(float64(k), 'g', -1, 32)
+	case float64:
+		typ, value = "float64", strconv.FormatFloat(k, 'g', -1, 64)
+	default:
+		return "", fmt.Errorf("postgrestore: JSONSerializer cannot coerce keys of type %T", key)
+	}
+	return keyTag + typ + ":" + value, nil
+}
+
+// decodeKey reverses encodeKey.
+func decodeKey(name string) (interface{}, error) {
+	if !strings.HasPrefix(name, keyTag) {
+		return name, nil
+	}
+	typ, value, ok := strings.Cut(name[len(keyTag):], ":")
+	if !ok {
+		return nil, fmt.Errorf("postgrestore: malformed coerced key %q", name)
+	}
+	var key interface{}
+	var err error
+	switch typ {
+	case "string":
+		key = value
+	case "bool":
+		key, err = strconv.ParseBool(value)
+	case "int":
+		var n int64
+		n, err = strconv.ParseInt(value, 10, strconv.IntSize)
+		key = int(n)
+	case "int8":
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 8)
+		key = int8(n)
+	case "int16":
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 16)
+		key = int16(n)
+	case "int32":
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 32)
+		key = int32(n)
+	case "int64":
+		key, err = strconv.ParseInt(value, 10, 64)
+	case "uint":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, strconv.IntSize)
+		key = uint(n)
+	case "uint8":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 8)
+		key = uint8(n)
+	case "uint16":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 16)
+		key = uint16(n)
+	case "uint32":
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 32)
+		key = uint32(n)
+	case "uint64":
+		key, err = strconv.ParseUint(value, 10, 64)
+	case "float32":
+		var f float64
+		f, err = strconv.ParseFloat(value, 32)
+		key = float32(f)
+	case "float64":
+		key, err = strconv.ParseFloat(value, 64)
+	default:
+		return nil, fmt.Errorf("postgrestore: unknown type in coerced key %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgrestore: malformed coerced key %q: %s", name, err)
+	}
+	return key, nil
+}
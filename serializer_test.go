@@ -0,0 +1,161 @@
+package postgrestore
+
+import (
+	"bytes"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_SerializersRoundTrip(t *testing.T) {
+	for _, serializer := range []Serializer{GobSerializer{}, JSONSerializer{}} {
+		session := sessions.NewSession(nil, "serializer-session")
+		session.Values["foo"] = "bar"
+		session.Values["quote"] = `say "hi" \o/`
+		data, err := serializer.Serialize(session)
+		if err != nil {
+			t.Fatalf("Error serializing with %T: %v", serializer, err)
+		}
+		loaded := sessions.NewSession(nil, "serializer-session")
+		if err = serializer.Deserialize(data, loaded); err != nil {
+			t.Fatalf("Error deserializing with %T: %v", serializer, err)
+		}
+		if loaded.Values["foo"] != "bar" || loaded.Values["quote"] != `say "hi" \o/` {
+			t.Errorf("Expected the values to round-trip with %T; Got %v", serializer, loaded.Values)
+		}
+	}
+}
+
+func Test_JSONSerializerErrors(t *testing.T) {
+	session := sessions.NewSession(nil, "serializer-session")
+	session.Values["ch"] = make(chan int)
+	if _, err := (JSONSerializer{}).Serialize(session); err == nil {
+		t.Errorf("Expected an error for a value that is not JSON marshalable")
+	}
+	session = sessions.NewSession(nil, "serializer-session")
+	session.Values[42] = "answer"
+	if _, err := (JSONSerializer{}).Serialize(session); err == nil {
+		t.Errorf("Expected an error for a non-string key")
+	}
+}
+
+func Test_JSONSerializerCoerceKeys(t *testing.T) {
+	serializer := JSONSerializer{CoerceKeys: true}
+	session := sessions.NewSession(nil, "serializer-session")
+	keys := []interface{}{"plain", "\x00tagged", true, 42, int8(-8), int16(16), int32(32), int64(-64),
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(1 << 63), float32(1.5), 0.1}
+	for i, key := range keys {
+		session.Values[key] = float64(i)
+	}
+	data, err := serializer.Serialize(session)
+	if err != nil {
+		t.Fatalf("Error serializing: %v", err)
+	}
+	loaded := sessions.NewSession(nil, "serializer-session")
+	if err = serializer.Deserialize(data, loaded); err != nil {
+		t.Fatalf("Error deserializing: %v", err)
+	}
+	if len(loaded.Values) != len(keys) {
+		t.Errorf("Expected %d keys; Got %v", len(keys), loaded.Values)
+	}
+	for i, key := range keys {
+		if loaded.Values[key] != float64(i) {
+			t.Errorf("Expected key %#v to round-trip; Got %v", key, loaded.Values)
+		}
+	}
+
+	type namedKey int
+	session.Values[namedKey(1)] = "named"
+	if _, err = serializer.Serialize(session); err == nil {
+		t.Errorf("Expected an error for a key of a named type")
+	}
+	if err = serializer.Deserialize([]byte(`{"\u0000int:x":1}`), loaded); err == nil {
+		t.Errorf("Expected an error for a malformed key")
+	}
+}
+
+type jsonUser struct {
+	Name   string `json:"name"`
+	Admin  bool   `json:"is_admin"`
+	secret string
+}
+
+func Test_JSONSerializerTypes(t *testing.T) {
+	serializer := JSONSerializer{Types: map[string]interface{}{"user": jsonUser{}, "owner": &jsonUser{}}}
+	session := sessions.NewSession(nil, "serializer-session")
+	session.Values["user"] = jsonUser{Name: "ann", Admin: true, secret: "s3cret"}
+	session.Values["owner"] = &jsonUser{Name: "bob"}
+	session.Values["count"] = 3
+	data, err := serializer.Serialize(session)
+	if err != nil {
+		t.Fatalf("Error serializing: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"user":{"name":"ann","is_admin":true}`)) {
+		t.Errorf("Expected the struct tags to name the stored fields; Got %s", data)
+	}
+
+	loaded := sessions.NewSession(nil, "serializer-session")
+	if err = serializer.Deserialize(data, loaded); err != nil {
+		t.Fatalf("Error deserializing: %v", err)
+	}
+	if user, ok := loaded.Values["user"].(jsonUser); !ok || user.Name != "ann" || !user.Admin || user.secret != "" {
+		t.Errorf("Expected a jsonUser without its unexported field; Got %#v", loaded.Values["user"])
+	}
+	if owner, ok := loaded.Values["owner"].(*jsonUser); !ok || owner.Name != "bob" {
+		t.Errorf("Expected a *jsonUser; Got %#v", loaded.Values["owner"])
+	}
+	if loaded.Values["count"] != float64(3) {
+		t.Errorf("Expected unregistered keys to decode as before; Got %#v", loaded.Values["count"])
+	}
+
+	if err = serializer.Deserialize([]byte(`{"user":null}`), loaded); err != nil || loaded.Values["user"] != nil {
+		t.Errorf("Expected a null value to load as nil; Got %#v, %v", loaded.Values["user"], err)
+	}
+	if err = serializer.Deserialize([]byte(`{"user":"ann"}`), loaded); err == nil {
+		t.Errorf("Expected an error for a value that does not fit the registered type")
+	}
+	session.Values["user"] = map[string]interface{}{"name": "ann"}
+	if _, err = serializer.Serialize(session); err == nil {
+		t.Errorf("Expected an error for a value of another type under a registered key")
+	}
+	if _, err = (JSONSerializer{Types: map[string]interface{}{"count": nil}}).Serialize(session); err == nil {
+		t.Errorf("Expected an error for a nil registration")
+	}
+}
+
+func Test_JSONSerializerStore(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Serializer: JSONSerializer{}})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.New(req, "json-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = `b\a"r`
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	var foo string
+	err = store.db.QueryRow("SELECT convert_from(data, 'UTF8')::jsonb ->> 'foo' FROM http_sessions WHERE id = $1;", session.ID).Scan(&foo)
+	if err != nil {
+		t.Fatalf("Error querying session data: %v", err)
+	}
+	if foo != `b\a"r` {
+		t.Errorf("Expected the stored JSON to hold foo; Got %q", foo)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	loaded, err := store.New(req, "json-session")
+	if err != nil || loaded.IsNew || loaded.Values["foo"] != `b\a"r` {
+		t.Errorf("Expected the session to round-trip; Got IsNew=%v, %v, %v", loaded.IsNew, loaded.Values, err)
+	}
+}
@@ -0,0 +1,79 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"time"
+)
+
+// CreateServerSession stores values as a new session that expires after ttl and returns its ID,
+// without an HTTP request or response, e.g. for an invite link sent by email.  name is the
+// session (cookie) name the data is encoded for.  The session reaches a browser once a handler
+// calls AdoptSession with the ID.
+func (dbStore *PGStore) CreateServerSession(ctx context.Context, name string, values map[interface{}]interface{}, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", errors.New("postgrestore: CreateServerSession requires a positive ttl")
+	}
+	session := sessions.NewSession(dbStore, name)
+	opts := *dbStore.Options
+	session.Options = &opts
+	for key, value := range values {
+		session.Values[key] = value
+	}
+	SetExpiry(session, time.Now().Add(ttl))
+	session.IsNew = true
+	if _, err := dbStore.insert(ctx, nil, session); err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// AdoptSession loads the session with the given name and ID, typically one created by
+// CreateServerSession, and sets the cookie that hands it to the client of r behind w.  Adoption
+// counts as the session's first use by that client: with Config.Fingerprint the session is bound
+// to the device of r, unless an earlier adoption already bound it, and it is loaded as by Get,
+// so a session idle for longer than Config.IdleTimeout since its creation or last use is
+// refused rather than revived.  Missing or expired sessions are reported as by PeekByID, a
+// session bound to another device as a fingerprint mismatch under FingerprintEnforce; no
+// cookie is set then.  The cookie carries the store's Options; the
+// session keeps the expiry it was created with.
+func (dbStore *PGStore) AdoptSession(ctx context.Context, r *http.Request, w http.ResponseWriter, name string, id string) (*sessions.Session, error) {
+	if err := dbStore.bindFingerprint(ctx, r, id); err != nil {
+		return nil, err
+	}
+	session := sessions.NewSession(dbStore, name)
+	session.ID = id
+	opts := *dbStore.Options
+	session.Options = dbStore.cookieOptions(r, &opts)
+	if err := dbStore.load(ctx, r, session, false); err != nil {
+		return nil, err
+	}
+	session.IsNew = false
+	if err := dbStore.WriteCookie(w, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// bindFingerprint records the device fingerprint of r for a session that has none yet, with
+// Config.Fingerprint.  The last access is left alone: load checks it before touching the row.
+// Binding a session that load then refuses is harmless, since it cannot be loaded anyway.
+func (dbStore *PGStore) bindFingerprint(ctx context.Context, r *http.Request, id string) error {
+	if dbStore.config.Fingerprint == nil {
+		return nil
+	}
+	query := fmt.Sprintf("UPDATE %s SET fingerprint = COALESCE(fingerprint, $2) WHERE id = $1 AND data <> ''%s;",
+		dbStore.table, dbStore.tenantCondition(3))
+	args := append([]interface{}{id, dbStore.fingerprint(r)}, dbStore.tenantArgs()...)
+	err := dbStore.withReconnect(func() error {
+		_, err := dbStore.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	if pqCode(err) == "22P02" { // invalid_text_representation, reported as missing by load
+		return nil
+	}
+	return classify(err)
+}
@@ -0,0 +1,140 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_CreateAndAdoptServerSession(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	values := map[interface{}]interface{}{"invite": "team-42"}
+	id, err := store.CreateServerSession(ctx, "invite-session", values, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating server session: %v", err)
+	}
+	defer store.stmtDelete.Exec(id)
+	if _, ok := values["expires_on"]; ok {
+		t.Errorf("Expected the caller's values to be left untouched")
+	}
+
+	m := httptest.NewRecorder()
+	adoptReq, _ := http.NewRequest("GET", "http://localhost:8080/invite", nil)
+	adopted, err := store.AdoptSession(ctx, adoptReq, m, "invite-session", id)
+	if err != nil {
+		t.Fatalf("Error adopting session: %v", err)
+	}
+	if adopted.Values["invite"] != "team-42" {
+		t.Errorf("Expected the adopted session to carry its values; Got %v", adopted.Values)
+	}
+	if expiresOn := adopted.Values["expires_on"].(time.Time); time.Until(expiresOn) < 23*time.Hour {
+		t.Errorf("Expected the session to keep its 24h ttl; Got %s", expiresOn)
+	}
+
+	// the issued cookie loads the session in a later request
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	session, err := store.New(req, "invite-session")
+	if err != nil || session.IsNew || session.ID != id {
+		t.Errorf("Expected the adopted session to load; Got IsNew=%v, %s, %v", session.IsNew, session.ID, err)
+	}
+
+	if _, err = store.AdoptSession(ctx, adoptReq, httptest.NewRecorder(), "invite-session", "0"); err == nil {
+		t.Errorf("Expected an error adopting a missing session")
+	}
+}
+
+func Test_AdoptSessionBindsDevice(t *testing.T) {
+	store, err := New(Config{
+		DSN:                   dbUrl,
+		KeyPairs:              [][]byte{[]byte("my-secret-key")},
+		Fingerprint:           func(r *http.Request) string { return r.UserAgent() },
+		FingerprintStrictness: FingerprintEnforce,
+	})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	id, err := store.CreateServerSession(ctx, "invite-session", map[interface{}]interface{}{"invite": "team-42"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating server session: %v", err)
+	}
+	defer store.stmtDelete.Exec(id)
+
+	device := func(userAgent string) *http.Request {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/invite", nil)
+		req.Header.Set("User-Agent", userAgent)
+		return req
+	}
+	m := httptest.NewRecorder()
+	if _, err = store.AdoptSession(ctx, device("browser-a"), m, "invite-session", id); err != nil {
+		t.Fatalf("Error adopting session: %v", err)
+	}
+
+	// the cookie issued to the adopting device does not load the session on another one
+	req := device("browser-b")
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	session, err := store.New(req, "invite-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if !session.IsNew || session.Values["invite"] != nil {
+		t.Errorf("Expected another device to get a new session; Got %s, %v", session.ID, session.Values)
+	}
+
+	// nor can another device adopt it again
+	m = httptest.NewRecorder()
+	if _, err = store.AdoptSession(ctx, device("browser-b"), m, "invite-session", id); !errors.Is(err, errFingerprintMismatch) {
+		t.Errorf("Expected a fingerprint mismatch adopting from another device; Got %v", err)
+	}
+	if cookie := m.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("Expected no cookie for a rejected adoption; Got %q", cookie)
+	}
+
+	// while the adopting device still can
+	if _, err = store.AdoptSession(ctx, device("browser-a"), httptest.NewRecorder(), "invite-session", id); err != nil {
+		t.Errorf("Error adopting session again from the same device: %v", err)
+	}
+}
+
+func Test_AdoptIdleSession(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, IdleTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	id, err := store.CreateServerSession(ctx, "invite-session", map[interface{}]interface{}{"invite": "team-42"}, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating server session: %v", err)
+	}
+	defer store.stmtDelete.Exec(id)
+	if _, err = store.db.Exec("UPDATE http_sessions SET last_accessed_at = now() - interval '1 hour' WHERE id = $1;", id); err != nil {
+		t.Fatalf("Error backdating last access: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/invite", nil)
+	m := httptest.NewRecorder()
+	if _, err = store.AdoptSession(ctx, req, m, "invite-session", id); err == nil {
+		t.Errorf("Expected an error adopting a session idle for longer than IdleTimeout")
+	}
+	if cookie := m.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("Expected no cookie for an idle session; Got %q", cookie)
+	}
+	var idle bool
+	if err = store.db.QueryRow("SELECT last_accessed_at < now() - interval '30 minutes' FROM http_sessions WHERE id = $1;", id).Scan(&idle); err != nil || !idle {
+		t.Errorf("Expected adoption to leave the last access alone; Got %v, %v", idle, err)
+	}
+}
@@ -0,0 +1,72 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrSessionCapReached is returned by Save for a new session when the client's address already
+// holds Config.MaxSessionsPerIP active sessions.  No session is stored.
+var ErrSessionCapReached = errors.New("postgrestore: too many sessions for this client")
+
+// addIPAddressColumn adds the "ip_address" column, and its index, if they are missing.
+func (dbStore *PGStore) addIPAddressColumn() error {
+	for _, stmt := range []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS ip_address TEXT;", dbStore.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (ip_address);", dbStore.indexName("ip_address"), dbStore.table),
+	} {
+		if _, err := dbStore.db.Exec(stmt); err != nil {
+			return fmt.Errorf("Unable to add ip_address column to the %s table: %s", dbStore.table, err.Error())
+		}
+	}
+	return nil
+}
+
+// ipAddress returns the client address of r to store with a new session, or NULL for sessions
+// created outside of a request.
+func ipAddress(r *http.Request) sql.NullString {
+	if r == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: clientIP(r), Valid: true}
+}
+
+// checkSessionCap returns ErrSessionCapReached if ip holds Config.MaxSessionsPerIP unexpired
+// sessions, counting only those created within Config.SessionCapWindow if it is set.  The count
+// stops at the cap, so an address holding millions of sessions costs no more than one at the
+// limit.  Concurrent inserts from one address may overshoot the cap by a few sessions.
+func (dbStore *PGStore) checkSessionCap(ctx context.Context, ip string) error {
+	max := dbStore.config.MaxSessionsPerIP
+	cond := "ip_address = $1 AND expires_on > now()"
+	args := []interface{}{ip, max}
+	if window := dbStore.config.SessionCapWindow; window > 0 {
+		cond += " AND created_on > $3"
+		args = append(args, time.Now().Add(-window))
+	}
+	cond += dbStore.tenantCondition(len(args) + 1)
+	args = append(args, dbStore.tenantArgs()...)
+	query := fmt.Sprintf("SELECT count(*) FROM (SELECT 1 FROM %s WHERE %s LIMIT $2) capped;", dbStore.table, cond)
+	readCtx, cancel := dbStore.readContext(ctx)
+	defer cancel()
+	var count int
+	err := dbStore.withReconnect(func() error {
+		return dbStore.db.QueryRowContext(readCtx, query, args...).Scan(&count)
+	})
+	if err != nil {
+		err = classify(err)
+		dbStore.reportDBError("insert", err)
+		return err
+	}
+	if count < max {
+		return nil
+	}
+	dbStore.logger.Printf("Refusing a new session for %s, it holds %d sessions already", ip, count)
+	if hook := dbStore.config.Hooks.OnSessionCapReached; hook != nil {
+		hook(ip)
+	}
+	return ErrSessionCapReached
+}
@@ -0,0 +1,50 @@
+package postgrestore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_MaxSessionsPerIP(t *testing.T) {
+	var refused []string
+	store, err := New(Config{
+		DSN:              dbUrl,
+		KeyPairs:         [][]byte{[]byte("my-secret-key")},
+		TableName:        "capped_sessions",
+		MaxSessionsPerIP: 2,
+		Hooks:            Hooks{OnSessionCapReached: func(ip string) { refused = append(refused, ip) }},
+	})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	if _, err = store.db.Exec("DELETE FROM capped_sessions;"); err != nil {
+		t.Fatalf("Error clearing sessions: %v", err)
+	}
+
+	save := func(remoteAddr string) error {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.RemoteAddr = remoteAddr
+		session, err := store.New(req, "capped-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		return store.Save(req, httptest.NewRecorder(), session)
+	}
+	for i := 0; i < 2; i++ {
+		if err = save("192.0.2.1:51234"); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+	}
+	if err = save("192.0.2.1:51235"); err != ErrSessionCapReached {
+		t.Errorf("Expected ErrSessionCapReached; Got %v", err)
+	}
+	if len(refused) != 1 || refused[0] != "192.0.2.1" {
+		t.Errorf("Expected the hook to be called for 192.0.2.1; Got %v", refused)
+	}
+	// other addresses are unaffected
+	if err = save("192.0.2.2:51234"); err != nil {
+		t.Errorf("Error saving session for another address: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StatsInterval is the width of the buckets returned by SessionStats.
+type StatsInterval string
+
+const (
+	StatsHourly StatsInterval = "hour"
+	StatsDaily  StatsInterval = "day"
+)
+
+// StatsBucket counts the sessions created within one interval starting at Start.
+type StatsBucket struct {
+	Start   time.Time
+	Created int64
+}
+
+// SessionStats summarises the sessions table for capacity planning.
+type SessionStats struct {
+	// Buckets holds the number of sessions created per interval, oldest first.  Intervals
+	// without any new session are omitted.
+	Buckets []StatsBucket
+	// Active is the number of sessions that have not expired yet.
+	Active int64
+	// AverageTTL is the mean time left until the active sessions expire.
+	AverageTTL time.Duration
+}
+
+// SessionStats buckets the sessions created during the last window by interval and reports the
+// number of active sessions along with their average remaining lifetime.  Expired rows that have
+// not been removed yet are still counted in the buckets.  Keep window short on large tables; the
+// bucket query scans every row created within it.
+func (dbStore *PGStore) SessionStats(ctx context.Context, window time.Duration, interval StatsInterval) (*SessionStats, error) {
+	if interval != StatsHourly && interval != StatsDaily {
+		return nil, errors.New("postgrestore: SessionStats requires StatsHourly or StatsDaily")
+	}
+	if window <= 0 {
+		return nil, errors.New("postgrestore: SessionStats requires a positive window")
+	}
+	stats := &SessionStats{}
+	err := dbStore.withReconnect(func() error {
+		stats.Buckets = nil
+		rows, err := dbStore.db.QueryContext(ctx,
+			fmt.Sprintf("SELECT date_trunc($1, created_on) AS bucket, count(*) FROM %s "+
+				"WHERE created_on >= $2%s GROUP BY bucket ORDER BY bucket;", dbStore.table, dbStore.tenantCondition(3)),
+			append([]interface{}{string(interval), time.Now().Add(-window)}, dbStore.tenantArgs()...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bucket StatsBucket
+			if err = rows.Scan(&bucket.Start, &bucket.Created); err != nil {
+				return err
+			}
+			stats.Buckets = append(stats.Buckets, bucket)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		var avgSeconds float64
+		err = dbStore.db.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT count(*), COALESCE(avg(extract(epoch FROM expires_on - now())), 0) FROM %s "+
+				"WHERE expires_on > now()%s;", dbStore.table, dbStore.tenantCondition(1)), dbStore.tenantArgs()...).Scan(&stats.Active, &avgSeconds)
+		stats.AverageTTL = time.Duration(avgSeconds * float64(time.Second))
+		return err
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return stats, nil
+}
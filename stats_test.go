@@ -0,0 +1,47 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_SessionStats(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	for i := 0; i < 2; i++ {
+		session, err := store.New(req, "stats-session")
+		if err != nil {
+			t.Fatalf("Error getting session: %v", err)
+		}
+		if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		defer store.Delete(httptest.NewRecorder(), session)
+	}
+
+	stats, err := store.SessionStats(context.Background(), 24*time.Hour, StatsHourly)
+	if err != nil {
+		t.Fatalf("Error fetching stats: %v", err)
+	}
+	if len(stats.Buckets) == 0 || stats.Buckets[len(stats.Buckets)-1].Created < 2 {
+		t.Errorf("Expected at least 2 sessions in the latest bucket; Got %#v", stats.Buckets)
+	}
+	if stats.Active < 2 {
+		t.Errorf("Expected at least 2 active sessions; Got %d", stats.Active)
+	}
+	if stats.AverageTTL <= 0 {
+		t.Errorf("Expected a positive average TTL; Got %v", stats.AverageTTL)
+	}
+
+	if _, err = store.SessionStats(context.Background(), time.Hour, StatsInterval("week")); err == nil {
+		t.Errorf("Expected an error for an unsupported interval")
+	}
+}
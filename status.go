@@ -0,0 +1,50 @@
+package postgrestore
+
+import (
+	"context"
+	"github.com/gorilla/sessions"
+	"net/http"
+)
+
+// SessionStatus tells how GetWithStatus came by the session it returns.
+type SessionStatus int
+
+const (
+	// SessionNew is a new session for a request that did not present a session cookie.
+	SessionNew SessionStatus = iota
+	// SessionLoaded is an existing session loaded from the database.
+	SessionLoaded
+	// SessionExpiredReset is a new session replacing one that has expired, idled out, been
+	// revoked or deleted, or was presented from another device.
+	SessionExpiredReset
+	// SessionDecodeFailedReset is a new session replacing one whose cookie or stored data could
+	// not be decoded, e.g. after a key rotation.
+	SessionDecodeFailedReset
+)
+
+// statusCached marks sessions the registry returned from its cache, without creating them.
+const statusCached SessionStatus = -1
+
+// String implements fmt.Stringer.
+func (s SessionStatus) String() string {
+	switch s {
+	case SessionNew:
+		return "new"
+	case SessionLoaded:
+		return "loaded"
+	case SessionExpiredReset:
+		return "expired-reset"
+	case SessionDecodeFailedReset:
+		return "decode-failed-reset"
+	}
+	return "unknown"
+}
+
+// GetWithStatus is like Get, but also reports whether the session was loaded, or why it is new,
+// so handlers can e.g. tell the user their session expired only when it actually did.  The
+// status is determined when the session enters the registry; later calls during the same request
+// report SessionLoaded or SessionNew.  An undecodable cookie is reported as
+// SessionDecodeFailedReset, and with Config.StrictCookies also as a *CookieError.
+func (dbStore *PGStore) GetWithStatus(r *http.Request, name string) (*sessions.Session, SessionStatus, error) {
+	return dbStore.register(context.Background(), r, name)
+}
@@ -0,0 +1,101 @@
+package postgrestore
+
+import (
+	"errors"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_GetWithStatusWithoutDatabase(t *testing.T) {
+	store := &PGStore{
+		Codecs:  securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		Options: &sessions.Options{Path: "/"},
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, status, err := store.GetWithStatus(req, "status-session")
+	if err != nil || !session.IsNew || status != SessionNew {
+		t.Errorf("Expected a new session; Got IsNew=%v, %v, %v", session.IsNew, status, err)
+	}
+	if _, status, _ = store.GetWithStatus(req, "status-session"); status != SessionNew {
+		t.Errorf("Expected the cached session to be reported as new; Got %v", status)
+	}
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.AddCookie(&http.Cookie{Name: "status-session", Value: "garbage"})
+	session, status, _ = store.GetWithStatus(req, "status-session")
+	if !session.IsNew || status != SessionDecodeFailedReset {
+		t.Errorf("Expected a reset after a decode failure; Got IsNew=%v, %v", session.IsNew, status)
+	}
+	if session.Store() != store {
+		t.Errorf("Expected the session to belong to the store; Got %T", session.Store())
+	}
+}
+
+func Test_UndecodableCookie(t *testing.T) {
+	store := &PGStore{
+		Codecs:  securecookie.CodecsFromPairs([]byte("my-secret-key")),
+		Options: &sessions.Options{Path: "/"},
+	}
+	foreign, err := securecookie.EncodeMulti("tampered-session", "42", securecookie.CodecsFromPairs([]byte("unknown-key"))...)
+	if err != nil {
+		t.Fatalf("Error encoding cookie: %v", err)
+	}
+
+	for name, value := range map[string]string{"garbage": "garbage", "unknown key": foreign} {
+		req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+		req.AddCookie(&http.Cookie{Name: "tampered-session", Value: value})
+		session, err := store.New(req, "tampered-session")
+		if err != nil || !session.IsNew || session.ID != "" {
+			t.Errorf("%s: Expected a fresh session without an error; Got IsNew=%v, ID=%q, %v", name, session.IsNew, session.ID, err)
+		}
+
+		store.config.StrictCookies = true
+		session, err = store.New(req, "tampered-session")
+		var cookieErr *CookieError
+		if !errors.As(err, &cookieErr) || cookieErr.Name != "tampered-session" {
+			t.Errorf("%s: Expected a CookieError in strict mode; Got %v", name, err)
+		}
+		if !session.IsNew || session.ID != "" {
+			t.Errorf("%s: Expected a fresh session in strict mode; Got IsNew=%v, ID=%q", name, session.IsNew, session.ID)
+		}
+		store.config.StrictCookies = false
+	}
+}
+
+func Test_GetWithStatus(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := store.New(req, "status-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	cookie := m.Header().Get("Set-Cookie")
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", cookie)
+	if _, status, err := store.GetWithStatus(req, "status-session"); err != nil || status != SessionLoaded {
+		t.Errorf("Expected the session to be loaded; Got %v, %v", status, err)
+	}
+
+	if err = store.Delete(httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", cookie)
+	if loaded, status, err := store.GetWithStatus(req, "status-session"); err != nil || !loaded.IsNew || status != SessionExpiredReset {
+		t.Errorf("Expected a reset of the deleted session; Got IsNew=%v, %v, %v", loaded.IsNew, status, err)
+	}
+}
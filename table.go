@@ -0,0 +1,62 @@
+package postgrestore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultTableName is the sessions table used when Config.TableName is not set.
+const defaultTableName = "http_sessions"
+
+// tableNamePattern restricts table names to lower case identifiers that need no quoting, and
+// leaves room for the suffixes of the index and companion table names derived from them.
+var tableNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,39}$`)
+
+// identifierPattern restricts schema and column names to lower case identifiers that need no
+// quoting.
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// qualify prefixes name with schema, if one is set.
+func qualify(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// unqualify strips the store's schema from name, as returned by companionName, for comparison
+// with the catalog.
+func (dbStore *PGStore) unqualify(name string) string {
+	if dbStore.schema == "" {
+		return name
+	}
+	return strings.TrimPrefix(name, dbStore.schema+".")
+}
+
+// inSchema returns a condition restricting the catalog column to schema, passed as parameter
+// $n, together with the parameters it adds.  Without a schema it restricts column to the
+// schemas on the search_path, since that is where unqualified statements look.
+func inSchema(column, schema string, n int) (string, []interface{}) {
+	if schema == "" {
+		return column + " = ANY(current_schemas(false))", nil
+	}
+	return fmt.Sprintf("%s = $%d", column, n), []interface{}{schema}
+}
+
+// companionName returns the schema qualified name of a table or function that belongs to the
+// sessions table, e.g. the table holding flashes for suffix "flashes".  The default table keeps
+// the historical "http_session_" prefix; other tables use their own name as the prefix.
+func (dbStore *PGStore) companionName(suffix string) string {
+	table := dbStore.unqualify(dbStore.table)
+	if table == defaultTableName {
+		return qualify(dbStore.schema, "http_session_"+suffix)
+	}
+	return qualify(dbStore.schema, table+"_"+suffix)
+}
+
+// indexName returns the name of the index on the sessions table for the given column.  Indexes
+// always live in the schema of their table, so the name is never qualified.
+func (dbStore *PGStore) indexName(column string) string {
+	return dbStore.unqualify(dbStore.table) + "_" + column + "_idx"
+}
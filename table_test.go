@@ -0,0 +1,173 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_TableNameValidation(t *testing.T) {
+	for _, name := range []string{"bad-name; drop", "Sessions", "1sessions", "a_name_that_is_far_too_long_to_leave_room_for_suffixes"} {
+		cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: name}
+		if err := cfg.validate(); err == nil {
+			t.Errorf("Expected an error for table name %q", name)
+		}
+	}
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "app_sessions"}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("Expected app_sessions to be accepted; Got %v", err)
+	}
+}
+
+func Test_CompanionNames(t *testing.T) {
+	store := &PGStore{table: defaultTableName}
+	if name := store.companionName("flashes"); name != "http_session_flashes" {
+		t.Errorf("Expected http_session_flashes; Got %s", name)
+	}
+	store.table = "app_sessions"
+	if name := store.companionName("flashes"); name != "app_sessions_flashes" {
+		t.Errorf("Expected app_sessions_flashes; Got %s", name)
+	}
+	if name := store.indexName("expires_on"); name != "app_sessions_expires_on_idx" {
+		t.Errorf("Expected app_sessions_expires_on_idx; Got %s", name)
+	}
+}
+
+func Test_SeparateTables(t *testing.T) {
+	first, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "first_sessions"})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer first.Close()
+	second, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "second_sessions"})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer second.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := first.New(req, "table-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["foo"] = "bar"
+	if err = first.Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer first.Delete(httptest.NewRecorder(), session)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	if loaded, err := first.New(req, "table-session"); err != nil || loaded.IsNew {
+		t.Errorf("Expected the session in first_sessions; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+	if loaded, _ := second.New(req, "table-session"); !loaded.IsNew {
+		t.Errorf("Expected the session not to be found in second_sessions")
+	}
+}
+
+func Test_SchemaQualifiedNames(t *testing.T) {
+	store := &PGStore{schema: "sessions", table: qualify("sessions", defaultTableName)}
+	if name := store.companionName("flashes"); name != "sessions.http_session_flashes" {
+		t.Errorf("Expected sessions.http_session_flashes; Got %s", name)
+	}
+	if name := store.indexName("expires_on"); name != "http_sessions_expires_on_idx" {
+		t.Errorf("Expected http_sessions_expires_on_idx; Got %s", name)
+	}
+	if cond, args := inSchema("table_schema", "", 2); cond != "table_schema = ANY(current_schemas(false))" || args != nil {
+		t.Errorf("Unexpected condition %q, %v without a schema", cond, args)
+	}
+	if cond, args := inSchema("table_schema", "sessions", 2); cond != "table_schema = $2" || len(args) != 1 {
+		t.Errorf("Unexpected condition %q, %v with a schema", cond, args)
+	}
+}
+
+func Test_SeparateSchemas(t *testing.T) {
+	var stores []*PGStore
+	for _, schema := range []string{"sessions_a", "sessions_b"} {
+		setup, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}})
+		if err != nil {
+			t.Fatalf("failed to open a database connection: %#v", err)
+		}
+		_, err = setup.db.Exec("CREATE SCHEMA IF NOT EXISTS " + schema + ";")
+		setup.Close()
+		if err != nil {
+			t.Fatalf("Error creating schema %s: %v", schema, err)
+		}
+		store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Schema: schema})
+		if err != nil {
+			t.Fatalf("Error creating store in schema %s: %v", schema, err)
+		}
+		defer store.Close()
+		if query := store.Statements()["select"]; !strings.Contains(query, "FROM "+schema+".http_sessions ") {
+			t.Errorf("Expected the select statement to use %s.http_sessions; Got %s", schema, query)
+		}
+		if err = store.VerifySchema(context.Background()); err != nil {
+			t.Errorf("Error verifying schema %s: %v", schema, err)
+		}
+		stores = append(stores, store)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	m := httptest.NewRecorder()
+	session, err := stores[0].New(req, "schema-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = stores[0].Save(req, m, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer stores[0].Delete(httptest.NewRecorder(), session)
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", m.Header().Get("Set-Cookie"))
+	if loaded, err := stores[0].New(req, "schema-session"); err != nil || loaded.IsNew {
+		t.Errorf("Expected the session in sessions_a; Got IsNew=%v, %v", loaded.IsNew, err)
+	}
+	if loaded, _ := stores[1].New(req, "schema-session"); !loaded.IsNew {
+		t.Errorf("Expected the session not to be found in sessions_b")
+	}
+}
+
+func Test_EphemeralSchema(t *testing.T) {
+	cfg := Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, EphemeralSchema: true, Schema: "sessions"}
+	if err := cfg.validate(); err == nil {
+		t.Errorf("Expected EphemeralSchema to be rejected together with Schema")
+	}
+
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, EphemeralSchema: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	other, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, EphemeralSchema: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer other.Close()
+	schema := store.schema
+	if !strings.HasPrefix(schema, "test_") || schema == other.schema {
+		t.Errorf("Expected distinct test_ schemas; Got %s and %s", schema, other.schema)
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "ephemeral-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	store.Close()
+	var exists bool
+	err = other.db.QueryRow("SELECT EXISTS(SELECT * FROM information_schema.schemata WHERE schema_name = $1);", schema).Scan(&exists)
+	if err != nil {
+		t.Fatalf("Error checking schema: %v", err)
+	}
+	if exists {
+		t.Errorf("Expected Close to drop schema %s", schema)
+	}
+}
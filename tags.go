@@ -0,0 +1,80 @@
+package postgrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errTagsDisabled is returned by the tag methods when the store was built without Config.Tags.
+var errTagsDisabled = errors.New("postgrestore: tags are not enabled for this store")
+
+// addTagsColumn adds the "tags" column, and the GIN index used to search it, if they are missing.
+func (dbStore *PGStore) addTagsColumn() error {
+	_, err := dbStore.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';", dbStore.table))
+	if err == nil {
+		_, err = dbStore.db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (tags);", dbStore.indexName("tags"), dbStore.table))
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to add tags column to the %s table: %s", dbStore.table, err.Error())
+	}
+	return nil
+}
+
+// AddTag labels the session with the given ID with tag, e.g. "impersonated".  Adding a tag the
+// session already carries is a no-op.
+func (dbStore *PGStore) AddTag(ctx context.Context, id string, tag string) error {
+	if !dbStore.tags {
+		return errTagsDisabled
+	}
+	err := dbStore.withReconnect(func() error {
+		_, err := dbStore.db.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET tags = array_append(tags, $1) WHERE id = $2 AND NOT tags @> ARRAY[$1]::TEXT[]%s;",
+				dbStore.table, dbStore.tenantCondition(3)), append([]interface{}{tag, id}, dbStore.tenantArgs()...)...)
+		return err
+	})
+	return classify(err)
+}
+
+// RemoveTag removes tag from the session with the given ID.
+func (dbStore *PGStore) RemoveTag(ctx context.Context, id string, tag string) error {
+	if !dbStore.tags {
+		return errTagsDisabled
+	}
+	err := dbStore.withReconnect(func() error {
+		_, err := dbStore.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET tags = array_remove(tags, $1) WHERE id = $2%s;",
+			dbStore.table, dbStore.tenantCondition(3)), append([]interface{}{tag, id}, dbStore.tenantArgs()...)...)
+		return err
+	})
+	return classify(err)
+}
+
+// ListByTag returns the IDs of all unexpired sessions carrying tag.
+func (dbStore *PGStore) ListByTag(ctx context.Context, tag string) ([]string, error) {
+	if !dbStore.tags {
+		return nil, errTagsDisabled
+	}
+	var ids []string
+	err := dbStore.withReconnect(func() error {
+		ids = nil
+		rows, err := dbStore.db.QueryContext(ctx,
+			fmt.Sprintf("SELECT id FROM %s WHERE tags @> ARRAY[$1]::TEXT[] AND expires_on > now()%s ORDER BY id;",
+				dbStore.table, dbStore.tenantCondition(2)), append([]interface{}{tag}, dbStore.tenantArgs()...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,61 @@
+package postgrestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Tags(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, Tags: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "tagged-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	if err = store.AddTag(ctx, session.ID, "impersonated"); err != nil {
+		t.Fatalf("Error adding tag: %v", err)
+	}
+	// adding the same tag twice is a no-op
+	if err = store.AddTag(ctx, session.ID, "impersonated"); err != nil {
+		t.Fatalf("Error adding tag: %v", err)
+	}
+	ids, err := store.ListByTag(ctx, "impersonated")
+	if err != nil {
+		t.Fatalf("Error listing by tag: %v", err)
+	}
+	if !containsID(ids, session.ID) {
+		t.Errorf("Expected %s in %v", session.ID, ids)
+	}
+
+	if err = store.RemoveTag(ctx, session.ID, "impersonated"); err != nil {
+		t.Fatalf("Error removing tag: %v", err)
+	}
+	if ids, err = store.ListByTag(ctx, "impersonated"); err != nil {
+		t.Fatalf("Error listing by tag: %v", err)
+	}
+	if containsID(ids, session.ID) {
+		t.Errorf("Expected %s to be untagged; Got %v", session.ID, ids)
+	}
+}
+
+func containsID(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package postgrestore
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// tenantPattern restricts Config.Tenant to short names that cannot be confused with one another
+// through whitespace, case folding in other tools, or invisible characters.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,62}$`)
+
+// addTenantColumn adds the "tenant" column, and its index, if they are missing.  The index leads
+// with the tenant and then the expiry, which serves CleanupTenant and DeleteTenant as well as the
+// tenant-wide listings; statements on single sessions find their row through the primary key.
+// It supersedes the single-column index earlier versions created, which is dropped.
+func (dbStore *PGStore) addTenantColumn() error {
+	for _, stmt := range []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS tenant TEXT;", dbStore.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (tenant, expires_on);", dbStore.indexName("tenant_expires_on"), dbStore.table),
+		fmt.Sprintf("DROP INDEX IF EXISTS %s;", qualify(dbStore.schema, dbStore.indexName("tenant"))),
+	} {
+		if _, err := dbStore.db.Exec(stmt); err != nil {
+			return fmt.Errorf("Unable to add tenant column to the %s table: %s", dbStore.table, err.Error())
+		}
+	}
+	return nil
+}
+
+// tenantCondition returns " AND tenant = $n" for stores with Config.Tenant, to be appended to
+// the WHERE clause of a statement on single sessions, or "" otherwise.
+func (dbStore *PGStore) tenantCondition(n int) string {
+	if dbStore.config.Tenant == "" {
+		return ""
+	}
+	return fmt.Sprintf(" AND tenant = $%d", n)
+}
+
+// tenantArgs returns the parameter bound by tenantCondition, if any.
+func (dbStore *PGStore) tenantArgs() []interface{} {
+	if dbStore.config.Tenant == "" {
+		return nil
+	}
+	return []interface{}{dbStore.config.Tenant}
+}
+
+// CleanupTenant is Cleanup restricted to the sessions of one tenant, as stamped by stores with
+// Config.Tenant.  It requires the "tenant" column, which such stores add.
+func (dbStore *PGStore) CleanupTenant(ctx context.Context, tenant string) (int64, error) {
+	return dbStore.cleanup(ctx, "tenant = $1 AND ", tenant)
+}
+
+// DeleteTenant removes every session of tenant, expired or not, and returns the number of rows
+// removed, e.g. when a tenant is offboarded.  The grace window does not apply.  It requires the
+// "tenant" column.
+func (dbStore *PGStore) DeleteTenant(ctx context.Context, tenant string) (int64, error) {
+	var removed int64
+	err := dbStore.withReconnectWrite(func() error {
+		result, err := dbStore.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE tenant = $1;", dbStore.table), tenant)
+		if err != nil {
+			return err
+		}
+		removed, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, classify(err)
+	}
+	return removed, nil
+}
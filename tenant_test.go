@@ -0,0 +1,66 @@
+package postgrestore
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Tenant(t *testing.T) {
+	ctx := context.Background()
+	stores := map[string]*PGStore{}
+	for _, tenant := range []string{"acme", "globex"} {
+		store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, TableName: "tenant_sessions", Tenant: tenant})
+		if err != nil {
+			t.Fatalf("failed to open a database connection: %#v", err)
+		}
+		defer store.Close()
+		if _, err = store.DeleteTenant(ctx, tenant); err != nil {
+			t.Fatalf("Error deleting tenant: %v", err)
+		}
+		stores[tenant] = store
+	}
+	acme, globex := stores["acme"], stores["globex"]
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := acme.New(req, "tenant-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = acme.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	if _, err = globex.PeekByID(ctx, "tenant-session", session.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected another tenant's session to be invisible; Got %v", err)
+	}
+	if err = globex.DeleteByID(ctx, session.ID); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	if _, err = acme.PeekByID(ctx, "tenant-session", session.ID); err != nil {
+		t.Errorf("Expected the session to survive a delete by another tenant; Got %v", err)
+	}
+	if n, err := acme.Count(ctx); err != nil || n != 1 {
+		t.Errorf("Expected 1 session for acme; Got %d, %v", n, err)
+	}
+	if n, err := globex.Count(ctx); err != nil || n != 0 {
+		t.Errorf("Expected 0 sessions for globex; Got %d, %v", n, err)
+	}
+	if _, err = globex.SessionInfo(ctx, session.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected another tenant's session info to be invisible; Got %v", err)
+	}
+	if _, _, err = globex.ExportRaw(ctx, session.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected another tenant's raw data to be invisible; Got %v", err)
+	}
+	if items, _, err := globex.ListSessions(ctx, "", 10); err != nil || len(items) != 0 {
+		t.Errorf("Expected no sessions listed for globex; Got %v, %v", items, err)
+	}
+	if _, err = globex.CleanupTenant(ctx, "globex"); err != nil {
+		t.Errorf("Error cleaning up tenant: %v", err)
+	}
+	if n, err := globex.DeleteTenant(ctx, "acme"); err != nil || n != 1 {
+		t.Errorf("Expected acme's session to be deleted; Got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,25 @@
+package postgrestore
+
+import (
+	"context"
+	"time"
+)
+
+// readContext bounds ctx by Config.ReadTimeout for a read.
+func (dbStore *PGStore) readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, dbStore.config.ReadTimeout)
+}
+
+// writeContext bounds ctx by Config.WriteTimeout for a write.
+func (dbStore *PGStore) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, dbStore.config.WriteTimeout)
+}
+
+// withTimeout returns ctx with a deadline timeout from now, or ctx unchanged if timeout is not
+// positive.  context.WithTimeout keeps an earlier deadline of ctx, so the tighter one wins.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,30 @@
+package postgrestore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_WithTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("Expected no deadline without a timeout")
+	}
+
+	ctx, cancel = withTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("Expected a deadline within a minute; Got %v", deadline)
+	}
+
+	// the caller's tighter deadline wins
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	ctx, cancel = withTimeout(parent, time.Minute)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+		t.Errorf("Expected the caller's deadline to be kept; Got %v", deadline)
+	}
+}
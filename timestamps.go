@@ -0,0 +1,122 @@
+package postgrestore
+
+import (
+	"database/sql"
+	"github.com/gorilla/sessions"
+	"time"
+)
+
+// CreatedOn returns when a loaded session was first saved.  It reports false for new sessions,
+// for stores with Config.OmitTimestamps, and when the application overwrote the value.
+func CreatedOn(session *sessions.Session) (time.Time, bool) {
+	return timestamp(session, "created_on")
+}
+
+// ModifiedOn returns when a loaded session was last saved, under the same conditions as
+// CreatedOn.  With Config.LeaveModifiedOnNull it also reports false for sessions that have not
+// been updated since they were created.
+func ModifiedOn(session *sessions.Session) (time.Time, bool) {
+	return timestamp(session, "modified_on")
+}
+
+// ExpiresOn returns when a loaded session expires, under the same conditions as CreatedOn.
+func ExpiresOn(session *sessions.Session) (time.Time, bool) {
+	return timestamp(session, "expires_on")
+}
+
+func timestamp(session *sessions.Session, key string) (time.Time, bool) {
+	t, ok := session.Values[key].(time.Time)
+	return t, ok
+}
+
+// defaultExpiryTolerance is the Config.ExpiryTolerance used when none is set.
+const defaultExpiryTolerance = time.Second
+
+// expired reports whether a session expiring at expiresOn has expired at now, allowing for
+// Config.ExpiryTolerance.
+func (dbStore *PGStore) expired(expiresOn, now time.Time) bool {
+	return now.Sub(expiresOn) > dbStore.expiryTolerance()
+}
+
+// expiryTolerance returns Config.ExpiryTolerance, or its default, as a duration of zero or more.
+func (dbStore *PGStore) expiryTolerance() time.Duration {
+	tolerance := dbStore.config.ExpiryTolerance
+	if tolerance == 0 {
+		return defaultExpiryTolerance
+	} else if tolerance < 0 {
+		return 0
+	}
+	return tolerance
+}
+
+// insertModifiedOn returns the "modified_on" value of a new row created at createdOn: the same
+// time, or NULL with Config.LeaveModifiedOnNull.
+func (dbStore *PGStore) insertModifiedOn(createdOn time.Time) interface{} {
+	if dbStore.config.LeaveModifiedOnNull {
+		return nil
+	}
+	return createdOn
+}
+
+// zeroIfNull scans a nullable timestamp into t, leaving the zero time for NULL.
+type zeroIfNull struct {
+	t *time.Time
+}
+
+// Scan implements sql.Scanner.
+func (z zeroIfNull) Scan(src interface{}) error {
+	var nt sql.NullTime
+	if err := nt.Scan(src); err != nil {
+		return err
+	}
+	*z.t = nt.Time
+	return nil
+}
+
+// nullIfZero returns t as a query parameter, or NULL for the zero time.
+func nullIfZero(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// expiryKey holds the expiry set with SetExpiry until the session is saved.  It is never
+// encoded.
+type expiryKey struct{}
+
+// SetExpiry makes the next Save store t as the expiry of the session, regardless of MaxAge and
+// Config.RefreshExpiry, e.g. to end it at exactly 3am tomorrow.  It works for new and loaded
+// sessions alike.  The cookie keeps its Options.MaxAge; shorten it as well if the browser
+// should drop the cookie along with the session.
+func SetExpiry(session *sessions.Session, t time.Time) {
+	session.Values[expiryKey{}] = t
+}
+
+// newExpiry returns the expiry Save writes for a loaded session: the one given to SetExpiry,
+// MaxAge seconds from now with Config.RefreshExpiry, or nil to keep the stored one.
+func (dbStore *PGStore) newExpiry(session *sessions.Session) interface{} {
+	if t, ok := session.Values[expiryKey{}].(time.Time); ok {
+		return t
+	}
+	if dbStore.config.RefreshExpiry {
+		return time.Now().Add(time.Second * time.Duration(session.Options.MaxAge))
+	}
+	return nil
+}
+
+// requestedExpiry returns the expiry of a session about to be inserted: the time given to
+// SetExpiry, the time.Time stored under "expires_on", or MaxAge seconds from now.
+func requestedExpiry(session *sessions.Session) (time.Time, error) {
+	if t, ok := session.Values[expiryKey{}].(time.Time); ok {
+		return t, nil
+	}
+	switch exOn := session.Values["expires_on"].(type) {
+	case nil:
+		return time.Now().Add(time.Second * time.Duration(session.Options.MaxAge)), nil
+	case time.Time:
+		return exOn, nil
+	default:
+		return time.Time{}, errInvalidExpiry
+	}
+}
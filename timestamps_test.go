@@ -0,0 +1,188 @@
+package postgrestore
+
+import (
+	"context"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_TimestampAccessors(t *testing.T) {
+	session := sessions.NewSession(&PGStore{}, "timestamp-session")
+	session.Options = &sessions.Options{MaxAge: 60}
+	for name, accessor := range map[string]func(*sessions.Session) (time.Time, bool){
+		"CreatedOn": CreatedOn, "ModifiedOn": ModifiedOn, "ExpiresOn": ExpiresOn,
+	} {
+		if ts, ok := accessor(session); ok || !ts.IsZero() {
+			t.Errorf("Expected %s to report nothing for a session that was not loaded; Got %v", name, ts)
+		}
+	}
+	if expiresOn, err := requestedExpiry(session); err != nil || time.Until(expiresOn) > time.Minute {
+		t.Errorf("Expected the expiry to follow MaxAge; Got %v, %v", expiresOn, err)
+	}
+
+	now := time.Now()
+	session.Values["created_on"] = now
+	session.Values["modified_on"] = now
+	session.Values["expires_on"] = now.Add(time.Hour)
+	if createdOn, ok := CreatedOn(session); !ok || !createdOn.Equal(now) {
+		t.Errorf("Expected CreatedOn %v; Got %v", now, createdOn)
+	}
+	if modifiedOn, ok := ModifiedOn(session); !ok || !modifiedOn.Equal(now) {
+		t.Errorf("Expected ModifiedOn %v; Got %v", now, modifiedOn)
+	}
+	if expiresOn, ok := ExpiresOn(session); !ok || !expiresOn.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected ExpiresOn %v; Got %v", now.Add(time.Hour), expiresOn)
+	}
+
+	session.Values["expires_on"] = "tomorrow"
+	if _, ok := ExpiresOn(session); ok {
+		t.Errorf("Expected no expiry once the value is overwritten")
+	}
+	if _, err := requestedExpiry(session); err != errInvalidExpiry {
+		t.Errorf("Expected errInvalidExpiry; Got %v", err)
+	}
+}
+
+func Test_SetExpiry(t *testing.T) {
+	store, err := NewPostgreSQLStore(dbUrl, "/", 60*60, []byte("my-secret-key"))
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "expiry-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	at := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	SetExpiry(session, at)
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+	if _, ok := session.Values[expiryKey{}]; ok {
+		t.Errorf("Expected Save to consume the expiry")
+	}
+
+	loaded, err := store.PeekByID(context.Background(), "expiry-session", session.ID)
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if expiresOn, _ := ExpiresOn(loaded); !expiresOn.Equal(at) {
+		t.Errorf("Expected expiry %v; Got %v", at, expiresOn)
+	}
+
+	// a plain save keeps the expiry, a new SetExpiry moves it
+	if err = store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if expiresOn, _ := ExpiresOn(loaded); !expiresOn.Equal(at) {
+		t.Errorf("Expected expiry %v to be kept; Got %v", at, expiresOn)
+	}
+	SetExpiry(loaded, at.Add(time.Hour))
+	if err = store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if expiresOn, _ := ExpiresOn(loaded); !expiresOn.Equal(at.Add(time.Hour)) {
+		t.Errorf("Expected expiry %v; Got %v", at.Add(time.Hour), expiresOn)
+	}
+}
+
+func Test_RefreshExpiry(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, RefreshExpiry: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "refresh-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	SetExpiry(session, time.Now().Add(time.Minute))
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	loaded, err := store.PeekByID(context.Background(), "refresh-session", session.ID)
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if expiresOn, _ := ExpiresOn(loaded); time.Until(expiresOn) < time.Hour {
+		t.Errorf("Expected the expiry to slide to MaxAge from now; Got %v", expiresOn)
+	}
+}
+
+func Test_ExpiryTolerance(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		tolerance time.Duration
+		expiresOn time.Time
+		expired   bool
+	}{
+		{0, now, false},
+		{0, now.Add(-999 * time.Millisecond), false},
+		{0, now.Add(-time.Second), false},
+		{0, now.Add(-time.Second - time.Microsecond), true},
+		{0, now.Add(time.Microsecond), false},
+		{5 * time.Second, now.Add(-4 * time.Second), false},
+		{5 * time.Second, now.Add(-6 * time.Second), true},
+		{-1, now, false},
+		{-1, now.Add(-time.Microsecond), true},
+	} {
+		store := &PGStore{config: Config{ExpiryTolerance: tc.tolerance}}
+		if expired := store.expired(tc.expiresOn, now); expired != tc.expired {
+			t.Errorf("Expected expired=%v for %s past expiry with tolerance %s; Got %v",
+				tc.expired, now.Sub(tc.expiresOn), tc.tolerance, expired)
+		}
+	}
+}
+
+func Test_LeaveModifiedOnNull(t *testing.T) {
+	store, err := New(Config{DSN: dbUrl, KeyPairs: [][]byte{[]byte("my-secret-key")}, LeaveModifiedOnNull: true})
+	if err != nil {
+		t.Fatalf("failed to open a database connection: %#v", err)
+	}
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "modified-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	if err = store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	defer store.Delete(httptest.NewRecorder(), session)
+
+	loaded, err := store.PeekByID(context.Background(), "modified-session", session.ID)
+	if err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if modifiedOn, ok := ModifiedOn(loaded); ok {
+		t.Errorf("Expected no modification time before the first update; Got %v", modifiedOn)
+	}
+	info, err := store.SessionInfo(context.Background(), session.ID)
+	if err != nil || !info.ModifiedOn.IsZero() {
+		t.Errorf("Expected a zero ModifiedOn; Got %v, %v", info, err)
+	}
+
+	if err = store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if loaded, err = store.PeekByID(context.Background(), "modified-session", session.ID); err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if _, ok := ModifiedOn(loaded); !ok {
+		t.Errorf("Expected a modification time after the update")
+	}
+}
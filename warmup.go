@@ -0,0 +1,66 @@
+package postgrestore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultWarmupTimeout bounds the warmup when Config.ConnectTimeout is unset.
+const defaultWarmupTimeout = 10 * time.Second
+
+// warmup opens up to n pooled connections concurrently and pings each of them, so that the pool
+// is populated before the store serves its first request.  All connections are held until every
+// one has been established, otherwise database/sql would simply hand the same connection out
+// again.  n is capped at the pool's MaxOpenConns.  Falling short is logged rather than returned:
+// a cold pool is slower, not broken.  It returns the number of connections warmed up.
+func (dbStore *PGStore) warmup(n int) int {
+	if max := dbStore.db.Stats().MaxOpenConnections; max > 0 && n > max {
+		dbStore.logger.Printf("Warming up %d connections instead of %d, the pool is limited to %d", max, n, max)
+		n = max
+	}
+	if n <= 0 {
+		return 0
+	}
+	timeout := dbStore.config.ConnectTimeout
+	if timeout <= 0 {
+		timeout = defaultWarmupTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		warmed   int
+		firstErr error
+	)
+	release := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			conn, err := dbStore.db.Conn(ctx)
+			if err == nil {
+				err = conn.PingContext(ctx)
+			}
+			mu.Lock()
+			if err == nil {
+				warmed++
+			} else if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			wg.Done()
+			if conn != nil {
+				<-release
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+	if warmed < n {
+		dbStore.logger.Printf("Warmed up only %d of %d connections: %s", warmed, n, firstErr.Error())
+	}
+	return warmed
+}
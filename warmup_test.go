@@ -0,0 +1,30 @@
+package postgrestore
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func Test_WarmupConnections(t *testing.T) {
+	var logged bytes.Buffer
+	ss, err := New(Config{
+		DSN:               dbUrl,
+		KeyPairs:          [][]byte{[]byte("my-secret-key")},
+		MaxOpenConns:      3,
+		WarmupConnections: 5,
+		Logger:            log.New(&logged, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get store: %v", err)
+	}
+	defer ss.Close()
+
+	if open := ss.db.Stats().OpenConnections; open != 3 {
+		t.Errorf("Expected 3 warmed up connections; Got %d", open)
+	}
+	if !strings.Contains(logged.String(), "limited to 3") {
+		t.Errorf("Expected the capped warmup to be logged; Got %q", logged.String())
+	}
+}